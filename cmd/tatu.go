@@ -1,30 +1,89 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/danielspk/tatu-lang/pkg/ast"
 	"github.com/danielspk/tatu-lang/pkg/builder"
+	"github.com/danielspk/tatu-lang/pkg/formatter"
 	"github.com/danielspk/tatu-lang/pkg/interpreter"
+	"github.com/danielspk/tatu-lang/pkg/lsp"
 	"github.com/danielspk/tatu-lang/pkg/pretty"
+	"github.com/danielspk/tatu-lang/pkg/repl"
+	"github.com/danielspk/tatu-lang/pkg/vm"
 )
 
 var version = "dev-mode"
 
+const (
+	backendInterpreter = "interp"
+	backendVM          = "vm"
+)
+
+// compiledExt is the extension of the serialized bytecode files.
+const compiledExt = ".tatuc"
+
+// sourceExt is the extension of the source files.
+const sourceExt = ".tatu"
+
+// historyFile is the file of the REPL history, in the home directory.
+const historyFile = ".tatu_history"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "compile" {
+		compileCommand(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		fmtCommand(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		lspCommand()
+		return
+	}
+
 	printTokens := flag.Bool("printTokens", false, "print the generated tokens")
 	printAST := flag.Bool("printAST", false, "print the generated AST")
 	printBytecode := flag.Bool("printBytecode", false, "print the byte codes")
 	printInfo := flag.Bool("printInfo", true, "print the tatu header info")
+	optimize := flag.Bool("optimize", false, "optimize the compiled bytecode")
+	backend := flag.String("backend", backendInterpreter, "execution backend: `interp` or `vm`")
 	flag.Parse()
 
-	if flag.NArg() == 0 {
-		exitWithError(fmt.Errorf("usage `tatu [arguments] <source file>`"), nil)
+	if *backend != backendInterpreter && *backend != backendVM {
+		exitWithError(fmt.Errorf("unknown backend `%s`: expected `%s` or `%s`", *backend, backendInterpreter, backendVM), nil)
+	}
+
+	if flag.NArg() == 0 || flag.Arg(0) == "repl" && flag.NArg() == 1 {
+		if *backend != backendInterpreter {
+			exitWithError(fmt.Errorf("the REPL only runs on the `%s` backend", backendInterpreter), nil)
+		}
+
+		runREPL(*printInfo)
+		return
 	}
 
 	filename := flag.Arg(0)
 
+	if filepath.Ext(filename) == compiledExt {
+		if *backend != backendVM && isFlagSet("backend") {
+			exitWithError(fmt.Errorf("bytecode file `%s` can only run on the `%s` backend", filename, backendVM), nil)
+		}
+
+		runCompiled(filename, *printBytecode, *printInfo)
+		return
+	}
+
 	// building from a source file
 	progBuilder := builder.NewProgramBuilderWithDefaults()
 	tokens, ast, err := progBuilder.BuildFromFile(filename)
@@ -33,8 +92,14 @@ func main() {
 	}
 
 	// compiling to bytecode
-	/*compiler := vm.NewCompiler()
-	code := compiler.Compile(ast)*/
+	var codes []*vm.Code
+
+	if *backend == backendVM || *printBytecode {
+		codes, err = compile(ast, *optimize)
+		if err != nil {
+			exitWithError(err, progBuilder.Sources())
+		}
+	}
 
 	if *printTokens {
 		for _, token := range tokens {
@@ -48,10 +113,9 @@ func main() {
 	}
 
 	if *printBytecode {
-		/*for _, b := range code.Code {
-			fmt.Printf("0x%02X ", b)
+		for _, code := range codes {
+			fmt.Println(pretty.FormatBytecode(code))
 		}
-		fmt.Println()*/
 	}
 
 	if *printInfo {
@@ -59,6 +123,12 @@ func main() {
 		fmt.Println(pretty.FormatRunningOutput())
 	}
 
+	if *backend == backendVM {
+		// evaluating by virtual machine
+		execute(codes, progBuilder.Sources())
+		return
+	}
+
 	// evaluating by interpreter
 	inter := interpreter.NewInterpreter()
 
@@ -70,15 +140,283 @@ func main() {
 
 		fmt.Println(result)
 	}
+}
+
+// compile compiles every top-level expression on its own, so each result can be printed like the interpreter does.
+func compile(program *ast.AST, optimize bool) ([]*vm.Code, error) {
+	var opts []vm.CompilerOption
+
+	if optimize {
+		opts = append(opts, vm.WithOptimizations())
+	}
+
+	compiler := vm.NewCompiler(opts...)
+	codes := make([]*vm.Code, 0, len(program.Program))
+
+	for _, expr := range program.Program {
+		code, err := compiler.CompileExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// compileCommand compiles a source file into a bytecode file: `tatu compile <source file> [-o <bytecode file>]`.
+func compileCommand(args []string) {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	output := flags.String("o", "", "output bytecode file (default: the source file with the `.tatuc` extension)")
+	optimize := flags.Bool("optimize", false, "optimize the compiled bytecode")
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		exitWithError(fmt.Errorf("usage `tatu compile <source file> [-o <bytecode file>]`"), nil)
+	}
+
+	filename := flags.Arg(0)
+
+	// flags can also follow the source file
+	_ = flags.Parse(flags.Args()[1:])
+
+	if flags.NArg() > 0 {
+		exitWithError(fmt.Errorf("unexpected argument `%s`", flags.Arg(0)), nil)
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + compiledExt
+	}
+
+	progBuilder := builder.NewProgramBuilderWithDefaults()
+	_, ast, err := progBuilder.BuildFromFile(filename)
+	if err != nil {
+		exitWithError(err, progBuilder.Sources())
+	}
+
+	codes, err := compile(ast, *optimize)
+	if err != nil {
+		exitWithError(err, progBuilder.Sources())
+	}
+
+	data, err := vm.Marshal(vm.NewProgram(codes, progBuilder.Sources()))
+	if err != nil {
+		exitWithError(err, nil)
+	}
+
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		exitWithError(err, nil)
+	}
+}
+
+// fmtCommand formats source files, or the standard input without files: `tatu fmt [-w | -check] [<path> ...]`.
+// Directories are formatted with all their `.tatu` files.
+func fmtCommand(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result to the source files instead of printing it")
+	check := flags.Bool("check", false, "list the files that are not formatted and fail if there is any")
+	_ = flags.Parse(args)
+
+	if *write && *check {
+		exitWithError(fmt.Errorf("`-w` and `-check` cannot be used together"), nil)
+	}
+
+	if *write && flags.NArg() == 0 {
+		exitWithError(fmt.Errorf("usage `tatu fmt -w <path> ...`"), nil)
+	}
+
+	sourceFormatter := formatter.NewFormatter()
+	unformatted := false
+
+	format := func(filename string, source []byte) []byte {
+		formatted, err := sourceFormatter.Format(source, filename)
+		if err != nil {
+			exitWithError(err, map[string][]byte{filename: source})
+		}
+
+		if *check && !bytes.Equal(source, formatted) {
+			fmt.Println(filename)
+			unformatted = true
+		}
+
+		return formatted
+	}
+
+	if flags.NArg() == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			exitWithError(err, nil)
+		}
+
+		if formatted := format("<stdin>", source); !*check {
+			_, _ = os.Stdout.Write(formatted)
+		}
+	}
+
+	for _, filename := range sourceFiles(flags.Args()) {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			exitWithError(err, nil)
+		}
 
-	// evaluating by virtual machine
-	/*machine := vm.NewVirtualMachine()
-	result, err := machine.Execute(code)
+		formatted := format(filename, source)
+
+		switch {
+		case *check:
+		case *write:
+			if bytes.Equal(source, formatted) {
+				continue
+			}
+
+			if err := os.WriteFile(filename, formatted, 0o644); err != nil {
+				exitWithError(err, nil)
+			}
+		default:
+			_, _ = os.Stdout.Write(formatted)
+		}
+	}
+
+	if unformatted {
+		os.Exit(1)
+	}
+}
+
+// lspCommand serves the Language Server Protocol on the standard input and output: `tatu lsp`.
+func lspCommand() {
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		// the standard output belongs to the protocol
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// sourceFiles returns the files of the paths, replacing the directories with the `.tatu` files they contain.
+func sourceFiles(paths []string) []string {
+	var files []string
+
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if file == path && !entry.IsDir() || !entry.IsDir() && filepath.Ext(file) == sourceExt {
+				files = append(files, file)
+			}
+
+			return nil
+		})
+		if err != nil {
+			exitWithError(err, nil)
+		}
+	}
+
+	return files
+}
+
+// runCompiled runs a bytecode file on the virtual machine, skipping the front end.
+func runCompiled(filename string, printBytecode, printInfo bool) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		exitWithError(err, nil)
+	}
+
+	program, err := vm.Unmarshal(data)
 	if err != nil {
-		exitWithError(err)
+		exitWithError(err, nil)
+	}
+
+	// source files are only used to report errors, as long as they did not change since compiling
+	sources := make(map[string][]byte, len(program.Sources))
+
+	for _, source := range program.Sources {
+		if content, err := os.ReadFile(source.File); err == nil && source.Matches(content) {
+			sources[source.File] = content
+		}
 	}
 
-	fmt.Println(result)*/
+	if printBytecode {
+		for _, code := range program.Codes {
+			fmt.Println(pretty.FormatBytecode(code))
+		}
+	}
+
+	if printInfo {
+		fmt.Println(pretty.FormatRunningExecution(version, filename))
+		fmt.Println(pretty.FormatRunningOutput())
+	}
+
+	execute(program.Codes, sources)
+}
+
+// execute runs every code unit on the same virtual machine printing each result.
+func execute(codes []*vm.Code, sources map[string][]byte) {
+	machine := vm.NewVirtualMachine()
+
+	for _, code := range codes {
+		result, err := machine.Execute(code)
+		if err != nil {
+			exitWithError(err, sources)
+		}
+
+		fmt.Println(result)
+	}
+}
+
+// runREPL starts an interactive session on the interpreter: `tatu repl` or `tatu` without a file.
+func runREPL(printInfo bool) {
+	if printInfo {
+		fmt.Println(pretty.FormatRunningExecution(version, "repl"))
+		fmt.Println("Type :help for the list of commands.")
+	}
+
+	session := repl.NewREPL(os.Stdout)
+
+	// piped input is read as is, a terminal gets line editing, history and completion
+	if !repl.IsTerminal(os.Stdin.Fd()) {
+		if err := session.Run(os.Stdin); err != nil {
+			exitWithError(err, nil)
+		}
+
+		return
+	}
+
+	editor := repl.NewEditor(os.Stdin, os.Stdout,
+		repl.WithHistory(loadHistory()),
+		repl.WithCompleter(session.Complete),
+		repl.WithRawMode(os.Stdin.Fd()),
+	)
+
+	if err := session.RunWith(editor); err != nil {
+		exitWithError(err, nil)
+	}
+}
+
+// loadHistory loads the REPL history from `~/.tatu_history`, keeping it in memory when the file is unavailable.
+func loadHistory() *repl.History {
+	if home, err := os.UserHomeDir(); err == nil {
+		if history, err := repl.LoadHistory(filepath.Join(home, historyFile)); err == nil {
+			return history
+		}
+	}
+
+	history, _ := repl.LoadHistory("")
+
+	return history
+}
+
+// isFlagSet checks if a flag was given in the command line.
+func isFlagSet(name string) bool {
+	set := false
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
 }
 
 func exitWithError(err error, sources map[string][]byte) {
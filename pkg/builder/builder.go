@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"github.com/danielspk/tatu-lang/pkg/ast"
+	"github.com/danielspk/tatu-lang/pkg/location"
 	"github.com/danielspk/tatu-lang/pkg/macro"
 	"github.com/danielspk/tatu-lang/pkg/parser"
 	"github.com/danielspk/tatu-lang/pkg/scanner"
@@ -33,31 +34,68 @@ type Analyzer interface {
 	Analyze(program *ast.AST) error
 }
 
+// IncludeError represents an error building a file included by another one, located on its `include` expression.
+type IncludeError struct {
+	File       string            // absolute path of the included file
+	IncludedBy string            // absolute path of the including file
+	Location   location.Location // location of the `include` expression
+	Err        error
+}
+
+// Error shows the error message with the include chain.
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("including file `%s` in `%s`: %v", e.File, e.IncludedBy, e.Err)
+}
+
+// Unwrap returns the error of the included file.
+func (e *IncludeError) Unwrap() error {
+	return e.Err
+}
+
 // ProgramBuilder is responsible for generating an AST of the program and resolving the inclusion of files and modules.
 type ProgramBuilder struct {
 	scanner     Scanner
 	parser      Parser
 	expander    Expander
 	analyzer    Analyzer
+	readFile    func(filename string) ([]byte, error)
 	parsedFiles map[string][]byte
 }
 
+// Option configures a ProgramBuilder.
+type Option func(pb *ProgramBuilder)
+
+// WithReadFile reads the files with a function instead of os.ReadFile, e.g. to build the unsaved files of an editor.
+func WithReadFile(readFile func(filename string) ([]byte, error)) Option {
+	return func(pb *ProgramBuilder) {
+		pb.readFile = readFile
+	}
+}
+
 // NewProgramBuilder builds a new ProgramBuilder.
-func NewProgramBuilder(scanner Scanner, parser Parser, expander Expander, analyzer Analyzer) *ProgramBuilder {
-	return &ProgramBuilder{
+func NewProgramBuilder(scanner Scanner, parser Parser, expander Expander, analyzer Analyzer, opts ...Option) *ProgramBuilder {
+	pb := &ProgramBuilder{
 		scanner:     scanner,
 		parser:      parser,
 		expander:    expander,
 		analyzer:    analyzer,
+		readFile:    os.ReadFile,
 		parsedFiles: make(map[string][]byte),
 	}
+
+	for _, opt := range opts {
+		opt(pb)
+	}
+
+	return pb
 }
 
 // NewProgramBuilderWithDefaults builds a new ProgramBuilder with defaults.
-func NewProgramBuilderWithDefaults() *ProgramBuilder {
+func NewProgramBuilderWithDefaults(opts ...Option) *ProgramBuilder {
 	return NewProgramBuilder(
 		scanner.NewScanner(), parser.NewParser(),
 		macro.NewExpander(), parser.NewSyntaxAnalyzer(),
+		opts...,
 	)
 }
 
@@ -80,7 +118,7 @@ func (pb *ProgramBuilder) BuildFromSource(source []byte, filename string) ([]tok
 func (pb *ProgramBuilder) buildFromFile(filename string) ([]token.Token, *ast.AST, error) {
 	filename = pb.fullPath(filename)
 
-	source, err := os.ReadFile(filename)
+	source, err := pb.readFile(filename)
 	if err != nil {
 		return nil, nil, fmt.Errorf("missing file `%s`: %w", filename, err)
 	}
@@ -111,7 +149,7 @@ func (pb *ProgramBuilder) buildFromSource(source []byte, filename string) ([]tok
 		expr := astNodes.Program[idx]
 
 		if includeFile, ok := pb.isIncludeExpr(expr); ok {
-			includeFilename := pb.resolveRefPath(filename, includeFile)
+			includeFilename := ResolvePath(filename, includeFile)
 
 			if pb.fileWasParsed(includeFilename) {
 				astNodes.Program = append(astNodes.Program[:idx], astNodes.Program[idx+1:]...)
@@ -121,7 +159,7 @@ func (pb *ProgramBuilder) buildFromSource(source []byte, filename string) ([]tok
 
 			incTokens, incASTNodes, err := pb.buildFromFile(includeFilename)
 			if err != nil {
-				return nil, nil, fmt.Errorf("including file `%s` in `%s`: %w", includeFilename, filename, err)
+				return nil, nil, &IncludeError{File: includeFilename, IncludedBy: filename, Location: expr.Location(), Err: err}
 			}
 
 			tokens = append(tokens, incTokens...)
@@ -180,8 +218,9 @@ func (pb *ProgramBuilder) fullPath(filename string) string {
 	return filepath.Clean(absPath)
 }
 
-// resolveRefPath resolves the absolute path of a destination file based on the reference file.
-func (pb *ProgramBuilder) resolveRefPath(referenceFile, destinationFile string) string {
+// ResolvePath resolves the absolute path of a destination file based on the reference file, e.g. an included
+// file relative to the including one.
+func ResolvePath(referenceFile, destinationFile string) string {
 	if filepath.IsAbs(destinationFile) {
 		return filepath.Clean(destinationFile)
 	}
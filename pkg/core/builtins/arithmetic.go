@@ -5,12 +5,13 @@ import (
 	"math"
 	"strings"
 
+	"github.com/danielspk/tatu-lang/pkg/core"
 	"github.com/danielspk/tatu-lang/pkg/runtime"
 )
 
 // RegisterArithmetic registers arithmetic operator natives.
 func RegisterArithmetic(env *runtime.Environment) {
-	env.DefineNative("+", runtime.NewNativeFunction(add))
+	env.DefineNative("+", core.NewAllocatingNative(env.Memory(), add))
 	env.DefineNative("-", runtime.NewNativeFunction(subtract))
 	env.DefineNative("*", runtime.NewNativeFunction(multiply))
 	env.DefineNative("/", runtime.NewNativeFunction(divide))
@@ -20,7 +21,7 @@ func RegisterArithmetic(env *runtime.Environment) {
 // add implements the + operator (addition and string concatenation).
 // Usage: (+ 1 2 3) => 6
 // Usage: (+ "hello" " " "world") => "hello world"
-func add(args ...runtime.Value) (runtime.Value, error) {
+func add(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "+"
 
 	if len(args) < 2 {
@@ -40,18 +41,25 @@ func add(args ...runtime.Value) (runtime.Value, error) {
 	}
 
 	if hasString {
-		var out strings.Builder
+		parts := make([]string, len(args))
+		length := 0
 
-		for _, arg := range args {
+		for i, arg := range args {
 			switch arg.Type() {
 			case runtime.StringType:
-				out.WriteString(arg.(runtime.String).Value)
+				parts[i] = arg.(runtime.String).Value
 			case runtime.NumberType:
-				out.WriteString(arg.(runtime.Number).String())
+				parts[i] = arg.(runtime.Number).String()
 			}
+
+			length += len(parts[i])
+		}
+
+		if err := mem.AllocString(length); err != nil {
+			return nil, err
 		}
 
-		return runtime.NewString(out.String()), nil
+		return runtime.NewString(strings.Join(parts, "")), nil
 	}
 
 	var total float64
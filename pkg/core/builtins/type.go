@@ -19,7 +19,7 @@ func RegisterTypes(env *runtime.Environment) {
 	env.DefineNative("is-map", runtime.NewNativeFunction(isMap))
 	env.DefineNative("is-nil", runtime.NewNativeFunction(isNil))
 	env.DefineNative("is-function", runtime.NewNativeFunction(isFunction))
-	env.DefineNative("to-string", runtime.NewNativeFunction(toString))
+	env.DefineNative("to-string", core.NewAllocatingNative(env.Memory(), toString))
 	env.DefineNative("to-number", runtime.NewNativeFunction(toNumber))
 	env.DefineNative("to-bool", runtime.NewNativeFunction(toBool))
 }
@@ -129,7 +129,7 @@ func isFunction(args ...runtime.Value) (runtime.Value, error) {
 
 // toString implements the to-string conversion function.
 // Usage: (to-string 42) => "42"
-func toString(args ...runtime.Value) (runtime.Value, error) {
+func toString(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "to-string"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -149,7 +149,7 @@ func toString(args ...runtime.Value) (runtime.Value, error) {
 		n := args[0].(runtime.Nil)
 		return runtime.NewString(n.String()), nil
 	default:
-		return runtime.NewString(args[0].String()), nil
+		return core.AccountString(mem, args[0].String())
 	}
 }
 
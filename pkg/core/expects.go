@@ -65,3 +65,12 @@ func ExpectMap(name string, argIndex int, arg runtime.Value) (runtime.Map, error
 
 	return arg.(runtime.Map), nil
 }
+
+// ExpectFunction validates that an argument is FUNC or NATIVE_FUNC and returns it.
+func ExpectFunction(name string, argIndex int, arg runtime.Value) (runtime.Value, error) {
+	if arg.Type() != runtime.FuncType && arg.Type() != runtime.NativeFuncType {
+		return nil, fmt.Errorf("`%s` expects FUNC at argument %d, got %s", name, argIndex+1, arg.Type())
+	}
+
+	return arg, nil
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+var errorType = reflect.TypeFor[error]()
+
+// NewGoFunction builds a native function that calls a Go function, converting its arguments from Tatu values
+// and its result back with runtime.ToGo and runtime.FromGo. The function can also return an error as its last result.
+func NewGoFunction(name string, fn any) (runtime.NativeFunction, error) {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+
+	if fnType == nil || fnType.Kind() != reflect.Func {
+		return runtime.NativeFunction{}, fmt.Errorf("cannot register `%s`: expected a function, got %T", name, fn)
+	}
+
+	for idx := range fnType.NumIn() {
+		param := fnType.In(idx)
+
+		if fnType.IsVariadic() && idx == fnType.NumIn()-1 {
+			param = param.Elem()
+		}
+
+		if err := runtime.CheckGoType(param); err != nil {
+			return runtime.NativeFunction{}, fmt.Errorf("cannot register `%s`: parameter %d: %w", name, idx+1, err)
+		}
+	}
+
+	results := fnType.NumOut()
+	returnsError := results > 0 && fnType.Out(results-1) == errorType
+
+	if returnsError {
+		results--
+	}
+
+	if results > 1 {
+		return runtime.NativeFunction{}, fmt.Errorf("cannot register `%s`: expected at most one result and an error", name)
+	}
+
+	if results == 1 {
+		if err := runtime.CheckGoType(fnType.Out(0)); err != nil {
+			return runtime.NativeFunction{}, fmt.Errorf("cannot register `%s`: result: %w", name, err)
+		}
+	}
+
+	return runtime.NewNativeFunction(func(args ...runtime.Value) (result runtime.Value, err error) {
+		in, err := goArguments(name, fnType, args)
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				result, err = nil, fmt.Errorf("`%s` panicked: %v", name, r)
+			}
+		}()
+
+		out := fnValue.Call(in)
+
+		if returnsError && !out[len(out)-1].IsNil() {
+			return nil, out[len(out)-1].Interface().(error)
+		}
+
+		if results == 0 {
+			return runtime.NewNil(), nil
+		}
+
+		return runtime.FromGo(out[0].Interface())
+	}), nil
+}
+
+// RegisterGoFunction defines a Go function as a native in a global scope, unless the name is already bound.
+func RegisterGoFunction(env *runtime.Environment, name string, fn any) error {
+	if _, ok := env.Lookup(name); ok {
+		return fmt.Errorf("cannot register `%s`: symbol already defined", name)
+	}
+
+	native, err := NewGoFunction(name, fn)
+	if err != nil {
+		return err
+	}
+
+	env.DefineNative(name, native)
+
+	return nil
+}
+
+// goArguments converts the arguments of a call to the parameters of a Go function.
+func goArguments(name string, fnType reflect.Type, args []runtime.Value) ([]reflect.Value, error) {
+	params := fnType.NumIn()
+
+	if fnType.IsVariadic() {
+		if len(args) < params-1 {
+			return nil, fmt.Errorf("`%s` expects at least %d argument(s), got %d", name, params-1, len(args))
+		}
+	} else if err := ExpectArgs(name, params, args); err != nil {
+		return nil, err
+	}
+
+	in := make([]reflect.Value, len(args))
+
+	for idx, arg := range args {
+		var param reflect.Type
+
+		if fnType.IsVariadic() && idx >= params-1 {
+			param = fnType.In(params - 1).Elem()
+		} else {
+			param = fnType.In(idx)
+		}
+
+		value := reflect.New(param)
+
+		if err := runtime.ToGo(arg, value.Interface()); err != nil {
+			var convErr *runtime.ConversionError
+
+			if errors.As(err, &convErr) {
+				return nil, fmt.Errorf("`%s` expects %s at argument %d%s, got %s", name, convErr.Expected, idx+1, convErr.Path, convErr.Found)
+			}
+
+			return nil, err
+		}
+
+		in[idx] = value.Elem()
+	}
+
+	return in, nil
+}
@@ -0,0 +1,34 @@
+package core
+
+import "github.com/danielspk/tatu-lang/pkg/runtime"
+
+// AllocatingFunction is a native function that accounts the strings and collections it builds.
+type AllocatingFunction func(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error)
+
+// NewAllocatingNative binds an allocating function to the memory of the environment it is registered in.
+func NewAllocatingNative(mem *runtime.Memory, fn AllocatingFunction) runtime.NativeFunction {
+	return runtime.NewNativeFunction(func(args ...runtime.Value) (runtime.Value, error) {
+		return fn(mem, args...)
+	})
+}
+
+// AccountString accounts a string a native has already built, as its length was unknown before building it,
+// e.g. a JSON encoding, and returns it as a value. The limits are checked after the fact, so natives knowing the
+// length in advance call Memory.AllocString before building the string instead.
+func AccountString(mem *runtime.Memory, value string) (runtime.Value, error) {
+	if err := mem.AllocString(len(value)); err != nil {
+		return nil, err
+	}
+
+	return runtime.NewString(value), nil
+}
+
+// AllocatingCallbackFunction is an allocating function that calls back functions received as arguments.
+type AllocatingCallbackFunction func(mem *runtime.Memory, call runtime.Caller, args ...runtime.Value) (runtime.Value, error)
+
+// NewAllocatingCallback binds an allocating callback function to the memory of the environment it is registered in.
+func NewAllocatingCallback(mem *runtime.Memory, fn AllocatingCallbackFunction) runtime.NativeFunction {
+	return runtime.NewCallbackFunction(func(call runtime.Caller, args ...runtime.Value) (runtime.Value, error) {
+		return fn(mem, call, args...)
+	})
+}
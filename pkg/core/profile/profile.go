@@ -0,0 +1,54 @@
+// Package profile defines the sets of modules a global scope can be built with.
+package profile
+
+import (
+	"io/fs"
+
+	"github.com/danielspk/tatu-lang/pkg/core/builtins"
+	"github.com/danielspk/tatu-lang/pkg/core/stdlib"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+// Full returns the builtins and the whole standard library, with access to the host file system.
+func Full() []runtime.Module {
+	return append(Pure(),
+		stdlib.RegisterFileSystem,
+		stdlib.RegisterRandom,
+		stdlib.RegisterTime,
+	)
+}
+
+// Pure returns the builtins and the standard library without file system access, time or random numbers.
+func Pure() []runtime.Module {
+	return []runtime.Module{
+		builtins.RegisterArithmetic,
+		builtins.RegisterComparison,
+		builtins.RegisterIO,
+		builtins.RegisterTypes,
+		stdlib.RegisterJSON,
+		stdlib.RegisterMap,
+		stdlib.RegisterMath,
+		stdlib.RegisterRegex,
+		stdlib.RegisterString,
+		stdlib.RegisterVector,
+	}
+}
+
+// ReadOnly returns the pure modules plus the file system functions that only read from fsys,
+// e.g. `(*os.Root).FS()` to jail the scripts in a directory.
+func ReadOnly(fsys fs.FS) []runtime.Module {
+	return append(Pure(), stdlib.ReadOnlyFileSystem(fsys))
+}
+
+// Jailed returns the pure modules plus every file system function operating on fsys,
+// e.g. a stdlib.RootedFileSystem or a stdlib.MemoryFileSystem.
+func Jailed(fsys stdlib.FileSystem) []runtime.Module {
+	return append(Pure(), stdlib.FileSystemModule(fsys))
+}
+
+// Register registers the modules in a global scope.
+func Register(env *runtime.Environment, modules []runtime.Module) {
+	for _, module := range modules {
+		module(env)
+	}
+}
@@ -3,35 +3,78 @@ package stdlib
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"math"
-	"os"
 	"path/filepath"
 
 	"github.com/danielspk/tatu-lang/pkg/core"
 	"github.com/danielspk/tatu-lang/pkg/runtime"
 )
 
-// RegisterFileSystem registers file system functions.
+// RegisterFileSystem registers file system functions operating on the host file system.
 func RegisterFileSystem(env *runtime.Environment) {
-	env.DefineNative("fs:read", runtime.NewNativeFunction(fsRead))
-	env.DefineNative("fs:read-lines", runtime.NewNativeFunction(fsReadLines))
-	env.DefineNative("fs:write", runtime.NewNativeFunction(fsWrite))
-	env.DefineNative("fs:append", runtime.NewNativeFunction(fsAppend))
-	env.DefineNative("fs:exists", runtime.NewNativeFunction(fsExists))
-	env.DefineNative("fs:list", runtime.NewNativeFunction(fsList))
-	env.DefineNative("fs:mkdir", runtime.NewNativeFunction(fsMkdir))
-	env.DefineNative("fs:move", runtime.NewNativeFunction(fsMove))
-	env.DefineNative("fs:delete", runtime.NewNativeFunction(fsDelete))
-	env.DefineNative("fs:is-dir", runtime.NewNativeFunction(fsIsDir))
-	env.DefineNative("fs:size", runtime.NewNativeFunction(fsSize))
+	FileSystemModule(HostFileSystem())(env)
+}
+
+// FileSystemModule returns a module with the file system functions operating on fsys,
+// e.g. a RootedFileSystem or a MemoryFileSystem.
+func FileSystemModule(fsys FileSystem) runtime.Module {
+	return func(env *runtime.Environment) {
+		files := &fileSystem{fsys: fsys, mem: env.Memory()}
+		files.registerReaders(env)
+
+		env.DefineNative("fs:write", runtime.NewNativeFunction(files.write))
+		env.DefineNative("fs:append", runtime.NewNativeFunction(files.append))
+		env.DefineNative("fs:mkdir", runtime.NewNativeFunction(files.mkdir))
+		env.DefineNative("fs:move", runtime.NewNativeFunction(files.move))
+		env.DefineNative("fs:delete", runtime.NewNativeFunction(files.delete))
+
+		// a temporary directory only makes sense on the host
+		if tmp, ok := fsys.(interface{ TempDir() string }); ok {
+			env.DefineNative("fs:temp-dir", runtime.NewNativeFunction(func(args ...runtime.Value) (runtime.Value, error) {
+				return fsTempDir(tmp.TempDir(), args...)
+			}))
+		}
+	}
+}
+
+// ReadOnlyFileSystem returns a module with the file system functions that only read, resolving paths in fsys.
+// Paths are slash-separated and relative to its root, so `..` cannot escape it;
+// use `(*os.Root).FS()` to also reject symlinks that point out of a directory.
+func ReadOnlyFileSystem(fsys fs.FS) runtime.Module {
+	return func(env *runtime.Environment) {
+		files := &fileSystem{fsys: fsys, mem: env.Memory()}
+		files.registerReaders(env)
+	}
+}
+
+// fileSystem holds the file system the functions operate on and the memory their results are accounted in.
+type fileSystem struct {
+	fsys fs.FS // a FileSystem for the functions that write
+	mem  *runtime.Memory
+}
+
+// registerReaders registers the file system functions that only read.
+func (f *fileSystem) registerReaders(env *runtime.Environment) {
+	env.DefineNative("fs:read", runtime.NewNativeFunction(f.read))
+	env.DefineNative("fs:read-lines", runtime.NewNativeFunction(f.readLines))
+	env.DefineNative("fs:exists", runtime.NewNativeFunction(f.exists))
+	env.DefineNative("fs:list", runtime.NewNativeFunction(f.list))
+	env.DefineNative("fs:is-dir", runtime.NewNativeFunction(f.isDir))
+	env.DefineNative("fs:size", runtime.NewNativeFunction(f.size))
 	env.DefineNative("fs:basename", runtime.NewNativeFunction(fsBasename))
-	env.DefineNative("fs:temp-dir", runtime.NewNativeFunction(fsTempDir))
 }
 
-// fsRead implements the file reading function.
+// writer returns the file system of the functions that write.
+func (f *fileSystem) writer() FileSystem {
+	return f.fsys.(FileSystem)
+}
+
+// read implements the file reading function.
 // Usage: (fs:read "file.txt") => "content"
-func fsRead(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) read(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:read"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -43,17 +86,17 @@ func fsRead(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	content, err := os.ReadFile(path.Value)
+	content, err := fs.ReadFile(f.fsys, path.Value)
 	if err != nil {
 		return nil, fmt.Errorf("`%s` failed to read file: %w", name, err)
 	}
 
-	return runtime.NewString(string(content)), nil
+	return core.AccountString(f.mem, string(content))
 }
 
-// fsReadLines implements the file reading by lines function.
+// readLines implements the file reading by lines function.
 // Usage: (fs:read-lines "file.txt") => (vector "line1" "line2")
-func fsReadLines(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) readLines(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:read-lines"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -65,17 +108,25 @@ func fsReadLines(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	content, err := os.ReadFile(path.Value)
+	content, err := fs.ReadFile(f.fsys, path.Value)
 	if err != nil {
 		return nil, fmt.Errorf("`%s` failed to read file: %w", name, err)
 	}
 
+	if err := f.mem.AllocString(len(content)); err != nil {
+		return nil, err
+	}
+
 	scanner := bufio.NewScanner(bytes.NewReader(content))
 	scanner.Buffer(nil, math.MaxInt32)
 
 	var elements []runtime.Value
 
 	for scanner.Scan() {
+		if err := f.mem.AllocElements(len(elements)+1, 1); err != nil {
+			return nil, err
+		}
+
 		elements = append(elements, runtime.NewString(scanner.Text()))
 	}
 
@@ -86,9 +137,9 @@ func fsReadLines(args ...runtime.Value) (runtime.Value, error) {
 	return runtime.NewVector(elements), nil
 }
 
-// fsWrite implements the file writing function.
+// write implements the file writing function.
 // Usage: (fs:write "file.txt" "content") => nil
-func fsWrite(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) write(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:write"
 
 	if err := core.ExpectArgs(name, 2, args); err != nil {
@@ -105,16 +156,16 @@ func fsWrite(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	if err = os.WriteFile(path.Value, []byte(content.Value), 0644); err != nil {
+	if err = f.writer().WriteFile(path.Value, []byte(content.Value)); err != nil {
 		return nil, fmt.Errorf("`%s` failed to write file: %w", name, err)
 	}
 
 	return runtime.NewNil(), nil
 }
 
-// fsAppend implements the file appending function.
+// append implements the file appending function.
 // Usage: (fs:append "file.txt" "more content") => nil
-func fsAppend(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) append(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:append"
 
 	if err := core.ExpectArgs(name, 2, args); err != nil {
@@ -131,22 +182,16 @@ func fsAppend(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	file, err := os.OpenFile(path.Value, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("`%s` failed to open file: %w", name, err)
-	}
-	defer file.Close()
-
-	if _, err = file.WriteString(content.Value); err != nil {
+	if err = f.writer().AppendFile(path.Value, []byte(content.Value)); err != nil {
 		return nil, fmt.Errorf("`%s` failed to append to file: %w", name, err)
 	}
 
 	return runtime.NewNil(), nil
 }
 
-// fsExists implements the file existence check function.
+// exists implements the file existence check function.
 // Usage: (fs:exists "file.txt") => true
-func fsExists(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) exists(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:exists"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -158,20 +203,20 @@ func fsExists(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	_, err = os.Stat(path.Value)
+	_, err = fs.Stat(f.fsys, path.Value)
 	if err == nil {
 		return runtime.NewBool(true), nil
 	}
-	if os.IsNotExist(err) {
+	if errors.Is(err, fs.ErrNotExist) {
 		return runtime.NewBool(false), nil
 	}
 
 	return nil, fmt.Errorf("`%s` failed to check file: %w", name, err)
 }
 
-// fsList implements the directory listing function.
+// list implements the directory listing function.
 // Usage: (fs:list "dir") => (vector "file1.txt" "file2.txt")
-func fsList(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) list(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:list"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -183,11 +228,15 @@ func fsList(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	entries, err := os.ReadDir(path.Value)
+	entries, err := fs.ReadDir(f.fsys, path.Value)
 	if err != nil {
 		return nil, fmt.Errorf("`%s` failed to list directory: %w", name, err)
 	}
 
+	if err := f.mem.AllocElements(len(entries), len(entries)); err != nil {
+		return nil, err
+	}
+
 	elements := make([]runtime.Value, len(entries))
 
 	for i, entry := range entries {
@@ -197,9 +246,9 @@ func fsList(args ...runtime.Value) (runtime.Value, error) {
 	return runtime.NewVector(elements), nil
 }
 
-// fsMkdir implements the directory creation function.
+// mkdir implements the directory creation function.
 // Usage: (fs:mkdir "newdir") => nil
-func fsMkdir(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) mkdir(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:mkdir"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -211,16 +260,16 @@ func fsMkdir(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	if err = os.MkdirAll(path.Value, 0755); err != nil {
+	if err = f.writer().MkdirAll(path.Value); err != nil {
 		return nil, fmt.Errorf("`%s` failed to create directory: %w", name, err)
 	}
 
 	return runtime.NewNil(), nil
 }
 
-// fsMove implements the file/directory moving function.
+// move implements the file/directory moving function.
 // Usage: (fs:move "old.txt" "new.txt") => nil
-func fsMove(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) move(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:move"
 
 	if err := core.ExpectArgs(name, 2, args); err != nil {
@@ -237,16 +286,16 @@ func fsMove(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	if err = os.Rename(oldPath.Value, newPath.Value); err != nil {
+	if err = f.writer().Rename(oldPath.Value, newPath.Value); err != nil {
 		return nil, fmt.Errorf("`%s` failed to move file: %w", name, err)
 	}
 
 	return runtime.NewNil(), nil
 }
 
-// fsDelete implements the file/directory deletion function.
+// delete implements the file/directory deletion function.
 // Usage: (fs:delete "file.txt") => nil
-func fsDelete(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) delete(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:delete"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -258,16 +307,16 @@ func fsDelete(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	if err = os.RemoveAll(path.Value); err != nil {
+	if err = f.writer().RemoveAll(path.Value); err != nil {
 		return nil, fmt.Errorf("`%s` failed to delete: %w", name, err)
 	}
 
 	return runtime.NewNil(), nil
 }
 
-// fsIsDir implements the directory check function.
+// isDir implements the directory check function.
 // Usage: (fs:is-dir "path") => true
-func fsIsDir(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) isDir(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:is-dir"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -279,7 +328,7 @@ func fsIsDir(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	info, err := os.Stat(path.Value)
+	info, err := fs.Stat(f.fsys, path.Value)
 	if err != nil {
 		return nil, fmt.Errorf("`%s` failed to check path: %w", name, err)
 	}
@@ -287,9 +336,9 @@ func fsIsDir(args ...runtime.Value) (runtime.Value, error) {
 	return runtime.NewBool(info.IsDir()), nil
 }
 
-// fsSize implements the file size function.
+// size implements the file size function.
 // Usage: (fs:size "file.txt") => 1024
-func fsSize(args ...runtime.Value) (runtime.Value, error) {
+func (f *fileSystem) size(args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:size"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -301,7 +350,7 @@ func fsSize(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	info, err := os.Stat(path.Value)
+	info, err := fs.Stat(f.fsys, path.Value)
 	if err != nil {
 		return nil, fmt.Errorf("`%s` failed to get file info: %w", name, err)
 	}
@@ -330,12 +379,12 @@ func fsBasename(args ...runtime.Value) (runtime.Value, error) {
 
 // fsTempDir implements the temporary directory function.
 // Usage: (fs:temp-dir) => "/tmp" or "C:\Users\...\Temp"
-func fsTempDir(args ...runtime.Value) (runtime.Value, error) {
+func fsTempDir(dir string, args ...runtime.Value) (runtime.Value, error) {
 	const name = "fs:temp-dir"
 
 	if err := core.ExpectArgs(name, 0, args); err != nil {
 		return nil, err
 	}
 
-	return runtime.NewString(os.TempDir()), nil
+	return runtime.NewString(dir), nil
 }
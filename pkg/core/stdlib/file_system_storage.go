@@ -0,0 +1,544 @@
+package stdlib
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSystem is the storage the file system functions operate on.
+// Paths are the ones given by the scripts: operating system paths for the host file system,
+// and slash-separated paths relative to the root for the others.
+type FileSystem interface {
+	fs.ReadFileFS
+	fs.ReadDirFS
+	fs.StatFS
+	WriteFile(name string, data []byte) error
+	AppendFile(name string, data []byte) error
+	MkdirAll(name string) error
+	Rename(oldname, newname string) error
+	RemoveAll(name string) error
+}
+
+// HostFileSystem returns the host file system, with unrestricted operating system paths.
+func HostFileSystem() FileSystem {
+	return hostFS{}
+}
+
+// RootedFileSystem returns a file system jailed in the directory of root.
+// Paths escaping it, through `..`, absolute paths or symlinks, are rejected.
+func RootedFileSystem(root *os.Root) FileSystem {
+	return rootedFS{root: root}
+}
+
+// hostFS operates on the host file system with operating system paths. Unlike os.DirFS, it is not rooted.
+type hostFS struct{}
+
+// Open opens a file.
+func (hostFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// ReadFile reads a whole file.
+func (hostFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// ReadDir reads a directory.
+func (hostFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// Stat returns the information of a file.
+func (hostFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// WriteFile creates or truncates a file with the given content.
+func (hostFS) WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, 0644)
+}
+
+// AppendFile appends content to a file, creating it if needed.
+func (hostFS) AppendFile(name string, data []byte) error {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	return appendFile(file, err, data)
+}
+
+// MkdirAll creates a directory and its missing parents.
+func (hostFS) MkdirAll(name string) error {
+	return os.MkdirAll(name, 0755)
+}
+
+// Rename moves a file or directory.
+func (hostFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+// RemoveAll removes a file or a directory and its children.
+func (hostFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+// TempDir returns the directory for temporary files.
+func (hostFS) TempDir() string {
+	return os.TempDir()
+}
+
+// rootedFS operates on a directory through os.Root, which rejects the paths that escape it.
+type rootedFS struct {
+	root *os.Root
+}
+
+// Open opens a file.
+func (r rootedFS) Open(name string) (fs.File, error) {
+	return r.root.Open(name)
+}
+
+// ReadFile reads a whole file.
+func (r rootedFS) ReadFile(name string) ([]byte, error) {
+	return r.root.ReadFile(name)
+}
+
+// ReadDir reads a directory sorted by name, like os.ReadDir.
+func (r rootedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	dir, err := r.root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	entries, err := dir.ReadDir(-1)
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries, err
+}
+
+// Stat returns the information of a file.
+func (r rootedFS) Stat(name string) (fs.FileInfo, error) {
+	return r.root.Stat(name)
+}
+
+// WriteFile creates or truncates a file with the given content.
+func (r rootedFS) WriteFile(name string, data []byte) error {
+	return r.root.WriteFile(name, data, 0644)
+}
+
+// AppendFile appends content to a file, creating it if needed.
+func (r rootedFS) AppendFile(name string, data []byte) error {
+	file, err := r.root.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	return appendFile(file, err, data)
+}
+
+// MkdirAll creates a directory and its missing parents.
+func (r rootedFS) MkdirAll(name string) error {
+	return r.root.MkdirAll(name, 0755)
+}
+
+// Rename moves a file or directory.
+func (r rootedFS) Rename(oldname, newname string) error {
+	return r.root.Rename(oldname, newname)
+}
+
+// RemoveAll removes a file or a directory and its children.
+func (r rootedFS) RemoveAll(name string) error {
+	return r.root.RemoveAll(name)
+}
+
+// appendFile writes content to a file opened for appending and closes it.
+func appendFile(file *os.File, err error, data []byte) error {
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// MemoryFileSystem is an in-memory file system, e.g. to test scripts that write files without touching the disk.
+// Paths are slash-separated and relative to its root. Directories holding files exist implicitly.
+type MemoryFileSystem struct {
+	mu    sync.RWMutex
+	files map[string]*memFile // files and created directories by path
+}
+
+// memFile is a file or a created directory of a MemoryFileSystem.
+type memFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemoryFileSystem builds a new MemoryFileSystem holding the given files.
+func NewMemoryFileSystem(files map[string]string) *MemoryFileSystem {
+	m := &MemoryFileSystem{files: make(map[string]*memFile, len(files))}
+
+	for name, content := range files {
+		m.files[name] = &memFile{data: []byte(content), mode: 0644, modTime: time.Now()}
+	}
+
+	return m
+}
+
+// Open opens a file.
+func (m *MemoryFileSystem) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, err := m.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		entries, err := m.readDir("open", name)
+
+		return &memDir{info: info, entries: entries}, err
+	}
+
+	return &memReader{Reader: bytes.NewReader(info.file.data), info: info}, nil
+}
+
+// ReadFile reads a whole file.
+func (m *MemoryFileSystem) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, err := m.stat("read", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+
+	return slices.Clone(info.file.data), nil
+}
+
+// ReadDir reads a directory sorted by name.
+func (m *MemoryFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.readDir("readdir", name)
+}
+
+// Stat returns the information of a file.
+func (m *MemoryFileSystem) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.stat("stat", name)
+}
+
+// WriteFile creates or truncates a file with the given content.
+func (m *MemoryFileSystem) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable("write", name); err != nil {
+		return err
+	}
+
+	m.files[name] = &memFile{data: slices.Clone(data), mode: 0644, modTime: time.Now()}
+
+	return nil
+}
+
+// AppendFile appends content to a file, creating it if needed.
+func (m *MemoryFileSystem) AppendFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable("append", name); err != nil {
+		return err
+	}
+
+	var content []byte
+
+	if file, ok := m.files[name]; ok {
+		content = file.data
+	}
+
+	// open files keep reading the previous content
+	m.files[name] = &memFile{data: append(slices.Clone(content), data...), mode: 0644, modTime: time.Now()}
+
+	return nil
+}
+
+// MkdirAll creates a directory and, implicitly, its parents.
+func (m *MemoryFileSystem) MkdirAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, err := m.stat("mkdir", name)
+
+	switch {
+	case err == nil && info.IsDir():
+		return nil
+	case err == nil:
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	case errors.Is(err, fs.ErrInvalid):
+		return err
+	}
+
+	m.files[name] = &memFile{mode: fs.ModeDir | 0755, modTime: time.Now()}
+
+	return nil
+}
+
+// Rename moves a file or directory.
+func (m *MemoryFileSystem) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) || oldname == "." || newname == "." {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+
+	if _, err := m.stat("rename", oldname); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+
+	if _, ok := cutPath(newname, oldname); ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+
+	moved := make(map[string]*memFile)
+
+	for name, file := range m.files {
+		if rest, ok := cutPath(name, oldname); ok {
+			delete(m.files, name)
+			moved[path.Join(newname, rest)] = file
+		}
+	}
+
+	maps.Copy(m.files, moved)
+
+	return nil
+}
+
+// RemoveAll removes a file or a directory and its children.
+func (m *MemoryFileSystem) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+
+	for file := range m.files {
+		if _, ok := cutPath(file, name); ok {
+			delete(m.files, file)
+		}
+	}
+
+	return nil
+}
+
+// writable checks that a file can be written: a valid path that is not a directory, in an existing directory.
+func (m *MemoryFileSystem) writable(op, name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	if info, err := m.stat(op, name); err == nil && info.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: errors.New("is a directory")}
+	}
+
+	if info, err := m.stat(op, path.Dir(name)); err != nil || !info.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return nil
+}
+
+// stat returns the information of a file or a directory, created or holding files.
+func (m *MemoryFileSystem) stat(op, name string) (*memInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	if file, ok := m.files[name]; ok {
+		return &memInfo{name: path.Base(name), file: file}, nil
+	}
+
+	for file := range m.files {
+		if _, ok := cutPath(file, name); ok {
+			return implicitDir(path.Base(name)), nil
+		}
+	}
+
+	if name == "." {
+		return implicitDir(name), nil
+	}
+
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// readDir returns the entries of a directory sorted by name.
+func (m *MemoryFileSystem) readDir(op, name string) ([]fs.DirEntry, error) {
+	info, err := m.stat(op, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+	}
+
+	children := make(map[string]*memInfo)
+
+	for file, content := range m.files {
+		rest, ok := cutPath(file, name)
+		if !ok || rest == "" {
+			continue
+		}
+
+		child, _, nested := strings.Cut(rest, "/")
+
+		switch _, seen := children[child]; {
+		case !nested:
+			children[child] = &memInfo{name: child, file: content}
+		case !seen:
+			children[child] = implicitDir(child)
+		}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+
+	for _, child := range slices.Sorted(maps.Keys(children)) {
+		entries = append(entries, fs.FileInfoToDirEntry(children[child]))
+	}
+
+	return entries, nil
+}
+
+// cutPath returns the rest of a path under a directory, or an empty rest for the directory itself.
+func cutPath(name, dir string) (string, bool) {
+	if name == dir {
+		return "", true
+	}
+
+	if dir == "." {
+		return name, true
+	}
+
+	return strings.CutPrefix(name, dir+"/")
+}
+
+// memInfo describes a file or a directory of a MemoryFileSystem.
+type memInfo struct {
+	name string
+	file *memFile
+}
+
+// implicitDir describes a directory that exists because it holds files.
+func implicitDir(name string) *memInfo {
+	return &memInfo{name: name, file: &memFile{mode: fs.ModeDir | 0755}}
+}
+
+// Name returns the base name of the file.
+func (i *memInfo) Name() string {
+	return i.name
+}
+
+// Size returns the length of the content of the file.
+func (i *memInfo) Size() int64 {
+	return int64(len(i.file.data))
+}
+
+// Mode returns the mode bits of the file.
+func (i *memInfo) Mode() fs.FileMode {
+	return i.file.mode
+}
+
+// ModTime returns the last modification time of the file.
+func (i *memInfo) ModTime() time.Time {
+	return i.file.modTime
+}
+
+// IsDir checks if the file is a directory.
+func (i *memInfo) IsDir() bool {
+	return i.file.mode.IsDir()
+}
+
+// Sys returns nil, there is no underlying data source.
+func (i *memInfo) Sys() any {
+	return nil
+}
+
+// memReader is an open file of a MemoryFileSystem.
+type memReader struct {
+	*bytes.Reader
+	info *memInfo
+}
+
+// Stat returns the information of the file.
+func (f *memReader) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// Close closes the file.
+func (f *memReader) Close() error {
+	return nil
+}
+
+// memDir is an open directory of a MemoryFileSystem, listing the entries it had when it was opened.
+type memDir struct {
+	info    *memInfo
+	entries []fs.DirEntry // entries not read yet
+}
+
+// Stat returns the information of the directory.
+func (d *memDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+// Read fails, a directory has no content.
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+// Close closes the directory.
+func (d *memDir) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries, or all the remaining ones when n <= 0.
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+
+	return entries, nil
+}
@@ -10,21 +10,23 @@ import (
 
 // RegisterJSON registers JSON functions.
 func RegisterJSON(env *runtime.Environment) {
-	env.DefineNative("json:encode", runtime.NewNativeFunction(jsonEncode))
-	env.DefineNative("json:decode", runtime.NewNativeFunction(jsonDecode))
+	mem := env.Memory()
+
+	env.DefineNative("json:encode", core.NewAllocatingNative(mem, jsonEncode))
+	env.DefineNative("json:decode", core.NewAllocatingNative(mem, jsonDecode))
 }
 
 // jsonEncode implements the JSON encoding function.
 // Usage: (json:encode (map "name" "John" "age" 30)) => "{\"age\":30,\"name\":\"John\"}"
-func jsonEncode(args ...runtime.Value) (runtime.Value, error) {
+func jsonEncode(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "json:encode"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
 		return nil, err
 	}
 
-	data, err := tatuToJSON(args[0])
-	if err != nil {
+	var data any
+	if err := runtime.ToGo(args[0], &data); err != nil {
 		return nil, fmt.Errorf("`%s` unsupported type: %w", name, err)
 	}
 
@@ -33,12 +35,12 @@ func jsonEncode(args ...runtime.Value) (runtime.Value, error) {
 		return nil, fmt.Errorf("`%s` failed to encode: %w", name, err)
 	}
 
-	return runtime.NewString(string(jsonBytes)), nil
+	return core.AccountString(mem, string(jsonBytes))
 }
 
 // jsonDecode implements the JSON decoding function.
 // Usage: (json:decode "{\"name\":\"John\",\"age\":30}") => (map "name" "John" "age" 30)
-func jsonDecode(args ...runtime.Value) (runtime.Value, error) {
+func jsonDecode(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "json:decode"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -55,7 +57,11 @@ func jsonDecode(args ...runtime.Value) (runtime.Value, error) {
 		return nil, fmt.Errorf("`%s` failed to decode: %w", name, err)
 	}
 
-	result, err := jsonToTatu(data)
+	if err = accountJSON(mem, data); err != nil {
+		return nil, err
+	}
+
+	result, err := runtime.FromGo(data)
 	if err != nil {
 		return nil, fmt.Errorf("`%s` failed to convert: %w", name, err)
 	}
@@ -63,82 +69,36 @@ func jsonDecode(args ...runtime.Value) (runtime.Value, error) {
 	return result, nil
 }
 
-// tatuToJSON converts a Tatu runtime.Value to a Go any for json.Marshal.
-func tatuToJSON(value runtime.Value) (any, error) {
-	switch value.Type() {
-	case runtime.NilType:
-		return nil, nil
-	case runtime.BoolType:
-		return value.(runtime.Bool).Value, nil
-	case runtime.NumberType:
-		return value.(runtime.Number).Value, nil
-	case runtime.StringType:
-		return value.(runtime.String).Value, nil
-	case runtime.VectorType:
-		vec := value.(*runtime.Vector)
-		result := make([]any, len(vec.Elements))
-
-		for i, elem := range vec.Elements {
-			val, err := tatuToJSON(elem)
-			if err != nil {
-				return nil, err
-			}
-			result[i] = val
-		}
-		return result, nil
-	case runtime.MapType:
-		m := value.(runtime.Map)
-		result := make(map[string]any)
-
-		for key, val := range m.Elements {
-			jsonVal, err := tatuToJSON(val)
-			if err != nil {
-				return nil, err
-			}
-			result[key] = jsonVal
-		}
-		return result, nil
-	default:
-		return nil, fmt.Errorf("cannot convert %s to JSON", value.Type())
-	}
-}
-
-// jsonToTatu converts a Go any from json.Unmarshal to a Tatu runtime.Value.
-func jsonToTatu(data any) (runtime.Value, error) {
-	if data == nil {
-		return runtime.NewNil(), nil
-	}
-
-	switch v := data.(type) {
-	case bool:
-		return runtime.NewBool(v), nil
-	case float64:
-		return runtime.NewNumber(v), nil
+// accountJSON accounts the strings and collections of a decoded JSON value, including the keys of its objects.
+func accountJSON(mem *runtime.Memory, data any) error {
+	switch value := data.(type) {
 	case string:
-		return runtime.NewString(v), nil
+		return mem.AllocString(len(value))
 	case []any:
-		elements := make([]runtime.Value, len(v))
+		if err := mem.AllocElements(len(value), len(value)); err != nil {
+			return err
+		}
 
-		for i, item := range v {
-			val, err := jsonToTatu(item)
-			if err != nil {
-				return nil, err
+		for _, element := range value {
+			if err := accountJSON(mem, element); err != nil {
+				return err
 			}
-			elements[i] = val
 		}
-		return runtime.NewVector(elements), nil
 	case map[string]any:
-		elements := make(map[string]runtime.Value)
+		if err := mem.AllocElements(len(value), len(value)); err != nil {
+			return err
+		}
 
-		for key, value := range v {
-			val, err := jsonToTatu(value)
-			if err != nil {
-				return nil, err
+		for key, element := range value {
+			if err := mem.AllocString(len(key)); err != nil {
+				return err
+			}
+
+			if err := accountJSON(mem, element); err != nil {
+				return err
 			}
-			elements[key] = val
 		}
-		return runtime.NewMap(elements), nil
-	default:
-		return nil, fmt.Errorf("unsupported JSON type: %T", v)
 	}
+
+	return nil
 }
@@ -10,15 +10,18 @@ import (
 
 // RegisterMap registers map functions.
 func RegisterMap(env *runtime.Environment) {
+	mem := env.Memory()
+
 	env.DefineNative("map:len", runtime.NewNativeFunction(mapLen))
 	env.DefineNative("map:get", runtime.NewNativeFunction(mapGet))
 	env.DefineNative("map:get-in", runtime.NewNativeFunction(mapGetIn))
-	env.DefineNative("map:set", runtime.NewNativeFunction(mapSet))
+	env.DefineNative("map:set", core.NewAllocatingNative(mem, mapSet))
 	env.DefineNative("map:delete", runtime.NewNativeFunction(mapDelete))
-	env.DefineNative("map:keys", runtime.NewNativeFunction(mapKeys))
-	env.DefineNative("map:values", runtime.NewNativeFunction(mapValues))
-	env.DefineNative("map:merge", runtime.NewNativeFunction(mapMerge))
+	env.DefineNative("map:keys", core.NewAllocatingNative(mem, mapKeys))
+	env.DefineNative("map:values", core.NewAllocatingNative(mem, mapValues))
+	env.DefineNative("map:merge", core.NewAllocatingNative(mem, mapMerge))
 	env.DefineNative("map:has", runtime.NewNativeFunction(mapHas))
+	env.DefineNative("map:update", core.NewAllocatingCallback(mem, mapUpdate))
 }
 
 // mapLen implements the map length function.
@@ -123,7 +126,7 @@ func mapGetIn(args ...runtime.Value) (runtime.Value, error) {
 
 // mapSet implements the map value assignment function.
 // Usage: (map:set my-map "key" value) => modified-map
-func mapSet(args ...runtime.Value) (runtime.Value, error) {
+func mapSet(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "map:set"
 
 	if err := core.ExpectArgs(name, 3, args); err != nil {
@@ -140,6 +143,12 @@ func mapSet(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
+	if _, ok := mapValue.Elements[key.Value]; !ok {
+		if err := mem.AllocElements(len(mapValue.Elements)+1, 1); err != nil {
+			return nil, err
+		}
+	}
+
 	mapValue.Elements[key.Value] = args[2]
 
 	return mapValue, nil
@@ -171,7 +180,7 @@ func mapDelete(args ...runtime.Value) (runtime.Value, error) {
 
 // mapKeys implements the map keys extraction function.
 // Usage: (map:keys my-map) => vector-of-keys
-func mapKeys(args ...runtime.Value) (runtime.Value, error) {
+func mapKeys(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "map:keys"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -183,6 +192,10 @@ func mapKeys(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
+	if err := mem.AllocElements(len(mapValue.Elements), len(mapValue.Elements)); err != nil {
+		return nil, err
+	}
+
 	keys := make([]string, 0, len(mapValue.Elements))
 
 	for key := range mapValue.Elements {
@@ -202,7 +215,7 @@ func mapKeys(args ...runtime.Value) (runtime.Value, error) {
 
 // mapValues implements the map values extraction function.
 // Usage: (map:values my-map) => vector-of-values
-func mapValues(args ...runtime.Value) (runtime.Value, error) {
+func mapValues(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "map:values"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -214,6 +227,10 @@ func mapValues(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
+	if err := mem.AllocElements(len(mapValue.Elements), len(mapValue.Elements)); err != nil {
+		return nil, err
+	}
+
 	keys := make([]string, 0, len(mapValue.Elements))
 
 	for k := range mapValue.Elements {
@@ -233,7 +250,7 @@ func mapValues(args ...runtime.Value) (runtime.Value, error) {
 
 // mapMerge implements the map merging function.
 // Usage: (map:merge my-map other-map) => modified-map
-func mapMerge(args ...runtime.Value) (runtime.Value, error) {
+func mapMerge(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "map:merge"
 
 	if err := core.ExpectArgs(name, 2, args); err != nil {
@@ -250,6 +267,18 @@ func mapMerge(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
+	added := 0
+
+	for key := range otherMap.Elements {
+		if _, ok := mapValue.Elements[key]; !ok {
+			added++
+		}
+	}
+
+	if err := mem.AllocElements(len(mapValue.Elements)+added, added); err != nil {
+		return nil, err
+	}
+
 	for key, value := range otherMap.Elements {
 		mapValue.Elements[key] = value
 	}
@@ -280,3 +309,48 @@ func mapHas(args ...runtime.Value) (runtime.Value, error) {
 
 	return runtime.NewBool(exists), nil
 }
+
+// mapUpdate implements the map value update function, calling a function with the current value or nil.
+// Usage: (map:update my-map "count" (lambda (n) (+ n 1))) => modified-map
+func mapUpdate(mem *runtime.Memory, call runtime.Caller, args ...runtime.Value) (runtime.Value, error) {
+	const name = "map:update"
+
+	if err := core.ExpectArgs(name, 3, args); err != nil {
+		return nil, err
+	}
+
+	mapValue, err := core.ExpectMap(name, 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := core.ExpectString(name, 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := core.ExpectFunction(name, 2, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	current, exists := mapValue.Elements[key.Value]
+	if !exists {
+		current = runtime.NewNil()
+	}
+
+	result, err := call(fn, current)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := mapValue.Elements[key.Value]; !ok {
+		if err := mem.AllocElements(len(mapValue.Elements)+1, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	mapValue.Elements[key.Value] = result
+
+	return mapValue, nil
+}
@@ -28,6 +28,10 @@ func RegisterMath(env *runtime.Environment) {
 	env.DefineNative("math:log", runtime.NewNativeFunction(mathLog))
 	env.DefineNative("math:exp", runtime.NewNativeFunction(mathExp))
 	env.DefineNative("math:between", runtime.NewNativeFunction(mathBetween))
+}
+
+// RegisterRandom registers the random number functions.
+func RegisterRandom(env *runtime.Environment) {
 	env.DefineNative("math:rand", runtime.NewNativeFunction(mathRand))
 }
 
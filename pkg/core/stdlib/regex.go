@@ -14,9 +14,11 @@ var regexCache sync.Map
 
 // RegisterRegex registers regular expression functions.
 func RegisterRegex(env *runtime.Environment) {
+	mem := env.Memory()
+
 	env.DefineNative("regex:matches", runtime.NewNativeFunction(regexMatches))
 	env.DefineNative("regex:find", runtime.NewNativeFunction(regexFind))
-	env.DefineNative("regex:replace", runtime.NewNativeFunction(regexReplace))
+	env.DefineNative("regex:replace", core.NewAllocatingNative(mem, regexReplace))
 }
 
 // regexMatches checks if a string matches a regular expression pattern.
@@ -81,7 +83,7 @@ func regexFind(args ...runtime.Value) (runtime.Value, error) {
 
 // regexReplace replaces all substrings that match a regular expression pattern with a replacement string.
 // Usage: (regex:replace "hello 123 world 456" "[0-9]+" "NUM") => "hello NUM world NUM"
-func regexReplace(args ...runtime.Value) (runtime.Value, error) {
+func regexReplace(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "regex:replace"
 
 	if err := core.ExpectArgs(name, 3, args); err != nil {
@@ -110,7 +112,7 @@ func regexReplace(args ...runtime.Value) (runtime.Value, error) {
 
 	result := re.ReplaceAllString(str.Value, replacement.Value)
 
-	return runtime.NewString(result), nil
+	return core.AccountString(mem, result)
 }
 
 func compileCached(name, pattern string) (*regexp.Regexp, error) {
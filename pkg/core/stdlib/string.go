@@ -10,21 +10,23 @@ import (
 
 // RegisterString registers string functions.
 func RegisterString(env *runtime.Environment) {
+	mem := env.Memory()
+
 	env.DefineNative("str:len", runtime.NewNativeFunction(stringLen))
 	env.DefineNative("str:contains", runtime.NewNativeFunction(stringContains))
 	env.DefineNative("str:index", runtime.NewNativeFunction(stringIndex))
-	env.DefineNative("str:upper", runtime.NewNativeFunction(stringUpper))
-	env.DefineNative("str:lower", runtime.NewNativeFunction(stringLower))
-	env.DefineNative("str:trim", runtime.NewNativeFunction(stringTrim))
-	env.DefineNative("str:slice", runtime.NewNativeFunction(stringSlice))
-	env.DefineNative("str:split", runtime.NewNativeFunction(stringSplit))
-	env.DefineNative("str:join", runtime.NewNativeFunction(stringJoin))
-	env.DefineNative("str:replace", runtime.NewNativeFunction(stringReplace))
+	env.DefineNative("str:upper", core.NewAllocatingNative(mem, stringUpper))
+	env.DefineNative("str:lower", core.NewAllocatingNative(mem, stringLower))
+	env.DefineNative("str:trim", core.NewAllocatingNative(mem, stringTrim))
+	env.DefineNative("str:slice", core.NewAllocatingNative(mem, stringSlice))
+	env.DefineNative("str:split", core.NewAllocatingNative(mem, stringSplit))
+	env.DefineNative("str:join", core.NewAllocatingNative(mem, stringJoin))
+	env.DefineNative("str:replace", core.NewAllocatingNative(mem, stringReplace))
 	env.DefineNative("str:starts", runtime.NewNativeFunction(stringStarts))
 	env.DefineNative("str:ends", runtime.NewNativeFunction(stringEnds))
-	env.DefineNative("str:reverse", runtime.NewNativeFunction(stringReverse))
-	env.DefineNative("str:repeat", runtime.NewNativeFunction(stringRepeat))
-	env.DefineNative("str:concat", runtime.NewNativeFunction(stringConcat))
+	env.DefineNative("str:reverse", core.NewAllocatingNative(mem, stringReverse))
+	env.DefineNative("str:repeat", core.NewAllocatingNative(mem, stringRepeat))
+	env.DefineNative("str:concat", core.NewAllocatingNative(mem, stringConcat))
 }
 
 // stringLen implements the string length function.
@@ -105,7 +107,7 @@ func stringIndex(args ...runtime.Value) (runtime.Value, error) {
 
 // stringUpper implements the string uppercase conversion function.
 // Usage: (str:upper "hello") => "HELLO"
-func stringUpper(args ...runtime.Value) (runtime.Value, error) {
+func stringUpper(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "str:upper"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -117,12 +119,12 @@ func stringUpper(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	return runtime.NewString(strings.ToUpper(str.Value)), nil
+	return core.AccountString(mem, strings.ToUpper(str.Value))
 }
 
 // stringLower implements the string lowercase conversion function.
 // Usage: (str:lower "HELLO") => "hello"
-func stringLower(args ...runtime.Value) (runtime.Value, error) {
+func stringLower(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "str:lower"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -134,12 +136,12 @@ func stringLower(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	return runtime.NewString(strings.ToLower(str.Value)), nil
+	return core.AccountString(mem, strings.ToLower(str.Value))
 }
 
 // stringTrim implements the string whitespace trimming function.
 // Usage: (str:trim "  hello  ") => "hello"
-func stringTrim(args ...runtime.Value) (runtime.Value, error) {
+func stringTrim(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "str:trim"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -151,12 +153,12 @@ func stringTrim(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
-	return runtime.NewString(strings.TrimSpace(str.Value)), nil
+	return core.AccountString(mem, strings.TrimSpace(str.Value))
 }
 
 // stringSlice implements the string slice extraction function.
 // Usage: (str:slice "hello" 1 4) => "ell"
-func stringSlice(args ...runtime.Value) (runtime.Value, error) {
+func stringSlice(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "str:slice"
 
 	if err := core.ExpectArgs(name, 3, args); err != nil {
@@ -194,12 +196,12 @@ func stringSlice(args ...runtime.Value) (runtime.Value, error) {
 		return nil, fmt.Errorf("`%s` start index (%d) cannot be greater than end index (%d)", name, start, end)
 	}
 
-	return runtime.NewString(string(runes[start:end])), nil
+	return core.AccountString(mem, string(runes[start:end]))
 }
 
 // stringSplit implements the string split function.
 // Usage: (str:split "a,b,c" ",") => ("a" "b" "c")
-func stringSplit(args ...runtime.Value) (runtime.Value, error) {
+func stringSplit(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "str:split"
 
 	if err := core.ExpectArgs(name, 2, args); err != nil {
@@ -217,6 +219,11 @@ func stringSplit(args ...runtime.Value) (runtime.Value, error) {
 	}
 
 	parts := strings.Split(str.Value, sep.Value)
+
+	if err := mem.AllocElements(len(parts), len(parts)); err != nil {
+		return nil, err
+	}
+
 	elements := make([]runtime.Value, len(parts))
 
 	for i, part := range parts {
@@ -228,7 +235,7 @@ func stringSplit(args ...runtime.Value) (runtime.Value, error) {
 
 // stringJoin implements the string join function.
 // Usage: (str:join (vector "a" "b" "c") ",") => "a,b,c"
-func stringJoin(args ...runtime.Value) (runtime.Value, error) {
+func stringJoin(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "str:join"
 
 	if err := core.ExpectArgs(name, 2, args); err != nil {
@@ -246,12 +253,18 @@ func stringJoin(args ...runtime.Value) (runtime.Value, error) {
 	}
 
 	parts := make([]string, len(vec.Elements))
+	length := len(sep.Value) * max(len(parts)-1, 0)
 
 	for i, elem := range vec.Elements {
 		if elem.Type() != runtime.StringType {
 			return nil, fmt.Errorf("`%s` expects vector of strings, got %s at index %d", name, elem.Type(), i)
 		}
 		parts[i] = elem.(runtime.String).Value
+		length += len(parts[i])
+	}
+
+	if err := mem.AllocString(length); err != nil {
+		return nil, err
 	}
 
 	return runtime.NewString(strings.Join(parts, sep.Value)), nil
@@ -259,7 +272,7 @@ func stringJoin(args ...runtime.Value) (runtime.Value, error) {
 
 // stringReplace implements the string replacement function.
 // Usage: (str:replace "hello world" "world" "Go") => "hello Go"
-func stringReplace(args ...runtime.Value) (runtime.Value, error) {
+func stringReplace(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "str:replace"
 
 	if err := core.ExpectArgs(name, 3, args); err != nil {
@@ -281,6 +294,13 @@ func stringReplace(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
+	// the replacements are counted first, so an oversized result is never built
+	matches := strings.Count(str.Value, oldStr.Value)
+
+	if err := mem.AllocString(len(str.Value) + matches*(len(newStr.Value)-len(oldStr.Value))); err != nil {
+		return nil, err
+	}
+
 	return runtime.NewString(strings.ReplaceAll(str.Value, oldStr.Value, newStr.Value)), nil
 }
 
@@ -330,7 +350,7 @@ func stringEnds(args ...runtime.Value) (runtime.Value, error) {
 
 // stringReverse implements the string reversal function.
 // Usage: (str:reverse "hello") => "olleh"
-func stringReverse(args ...runtime.Value) (runtime.Value, error) {
+func stringReverse(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "str:reverse"
 
 	if err := core.ExpectArgs(name, 1, args); err != nil {
@@ -348,12 +368,12 @@ func stringReverse(args ...runtime.Value) (runtime.Value, error) {
 		runes[i], runes[j] = runes[j], runes[i]
 	}
 
-	return runtime.NewString(string(runes)), nil
+	return core.AccountString(mem, string(runes))
 }
 
 // stringRepeat implements the string repetition function.
 // Usage: (str:repeat "ha" 3) => "hahaha"
-func stringRepeat(args ...runtime.Value) (runtime.Value, error) {
+func stringRepeat(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "str:repeat"
 
 	if err := core.ExpectArgs(name, 2, args); err != nil {
@@ -376,19 +396,29 @@ func stringRepeat(args ...runtime.Value) (runtime.Value, error) {
 		return nil, fmt.Errorf("`%s` count cannot be negative: %d", name, count)
 	}
 
+	length := len(str.Value) * count
+	if count > 0 && length/count != len(str.Value) {
+		return nil, fmt.Errorf("`%s` result is too large", name)
+	}
+
+	if err := mem.AllocString(length); err != nil {
+		return nil, err
+	}
+
 	return runtime.NewString(strings.Repeat(str.Value, count)), nil
 }
 
 // stringConcat implements the string concatenation function.
 // Usage: (str:concat "hello" " " "world") => "hello world"
-func stringConcat(args ...runtime.Value) (runtime.Value, error) {
+func stringConcat(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "str:concat"
 
 	if len(args) == 0 {
 		return runtime.NewString(""), nil
 	}
 
-	var result strings.Builder
+	parts := make([]string, len(args))
+	length := 0
 
 	for i, arg := range args {
 		str, err := core.ExpectString(name, i, arg)
@@ -396,8 +426,13 @@ func stringConcat(args ...runtime.Value) (runtime.Value, error) {
 			return nil, err
 		}
 
-		result.WriteString(str.Value)
+		parts[i] = str.Value
+		length += len(str.Value)
+	}
+
+	if err := mem.AllocString(length); err != nil {
+		return nil, err
 	}
 
-	return runtime.NewString(result.String()), nil
+	return runtime.NewString(strings.Join(parts, "")), nil
 }
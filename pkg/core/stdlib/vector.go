@@ -10,18 +10,23 @@ import (
 
 // RegisterVector registers vector functions.
 func RegisterVector(env *runtime.Environment) {
+	mem := env.Memory()
+
 	env.DefineNative("vec:len", runtime.NewNativeFunction(vectorLen))
 	env.DefineNative("vec:get", runtime.NewNativeFunction(vectorGet))
 	env.DefineNative("vec:set", runtime.NewNativeFunction(vectorSet))
 	env.DefineNative("vec:delete", runtime.NewNativeFunction(vectorDelete))
-	env.DefineNative("vec:push", runtime.NewNativeFunction(vectorPush))
+	env.DefineNative("vec:push", core.NewAllocatingNative(mem, vectorPush))
 	env.DefineNative("vec:pop", runtime.NewNativeFunction(vectorPop))
-	env.DefineNative("vec:slice", runtime.NewNativeFunction(vectorSlice))
-	env.DefineNative("vec:concat", runtime.NewNativeFunction(vectorConcat))
+	env.DefineNative("vec:slice", core.NewAllocatingNative(mem, vectorSlice))
+	env.DefineNative("vec:concat", core.NewAllocatingNative(mem, vectorConcat))
 	env.DefineNative("vec:contains", runtime.NewNativeFunction(vectorContains))
 	env.DefineNative("vec:find", runtime.NewNativeFunction(vectorFind))
 	env.DefineNative("vec:reverse", runtime.NewNativeFunction(vectorReverse))
-	env.DefineNative("vec:sort", runtime.NewNativeFunction(vectorSort))
+	env.DefineNative("vec:sort", runtime.NewCallbackFunction(vectorSort))
+	env.DefineNative("vec:map", core.NewAllocatingCallback(mem, vectorMap))
+	env.DefineNative("vec:filter", core.NewAllocatingCallback(mem, vectorFilter))
+	env.DefineNative("vec:reduce", runtime.NewCallbackFunction(vectorReduce))
 }
 
 // vectorLen implements the vector length function.
@@ -98,7 +103,7 @@ func vectorDelete(args ...runtime.Value) (runtime.Value, error) {
 
 // vectorPush implements the vector element append function.
 // Usage: (vec:push my-vector value) => modified-vector
-func vectorPush(args ...runtime.Value) (runtime.Value, error) {
+func vectorPush(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "vec:push"
 
 	if err := core.ExpectArgs(name, 2, args); err != nil {
@@ -110,6 +115,10 @@ func vectorPush(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
+	if err := mem.AllocElements(len(vector.Elements)+1, 1); err != nil {
+		return nil, err
+	}
+
 	vector.Elements = append(vector.Elements, args[1])
 
 	return vector, nil
@@ -140,7 +149,7 @@ func vectorPop(args ...runtime.Value) (runtime.Value, error) {
 
 // vectorSlice implements the vector slice extraction function.
 // Usage: (vec:slice my-vector start end) => new-vector
-func vectorSlice(args ...runtime.Value) (runtime.Value, error) {
+func vectorSlice(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "vec:slice"
 
 	if err := core.ExpectArgs(name, 3, args); err != nil {
@@ -177,6 +186,10 @@ func vectorSlice(args ...runtime.Value) (runtime.Value, error) {
 		return nil, fmt.Errorf("`%s` start index (%d) cannot be greater than end index (%d)", name, start, end)
 	}
 
+	if err := mem.AllocElements(end-start, end-start); err != nil {
+		return nil, err
+	}
+
 	newElements := make([]runtime.Value, end-start)
 	copy(newElements, vector.Elements[start:end])
 
@@ -185,7 +198,7 @@ func vectorSlice(args ...runtime.Value) (runtime.Value, error) {
 
 // vectorConcat implements the vector concatenation function.
 // Usage: (vec:concat my-vector other-vector) => modified-vector
-func vectorConcat(args ...runtime.Value) (runtime.Value, error) {
+func vectorConcat(mem *runtime.Memory, args ...runtime.Value) (runtime.Value, error) {
 	const name = "vec:concat"
 
 	if err := core.ExpectArgs(name, 2, args); err != nil {
@@ -202,6 +215,10 @@ func vectorConcat(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
+	if err := mem.AllocElements(len(vector.Elements)+len(otherVector.Elements), len(otherVector.Elements)); err != nil {
+		return nil, err
+	}
+
 	vector.Elements = append(vector.Elements, otherVector.Elements...)
 
 	return vector, nil
@@ -278,13 +295,14 @@ func vectorReverse(args ...runtime.Value) (runtime.Value, error) {
 	return vector, nil
 }
 
-// vectorSort sorts a vector in ascending order.
+// vectorSort sorts a vector in ascending order, or with a `less` function.
 // Usage: (vec:sort (vector 3 1 2)) => (vector 1 2 3)
-func vectorSort(args ...runtime.Value) (runtime.Value, error) {
+// Usage: (vec:sort (vector 3 1 2) (lambda (a b) (> a b))) => (vector 3 2 1)
+func vectorSort(call runtime.Caller, args ...runtime.Value) (runtime.Value, error) {
 	const name = "vec:sort"
 
-	if err := core.ExpectArgs(name, 1, args); err != nil {
-		return nil, err
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("`%s` expects 1 or 2 argument(s), got %d", name, len(args))
 	}
 
 	vector, err := core.ExpectVector(name, 0, args[0])
@@ -292,6 +310,10 @@ func vectorSort(args ...runtime.Value) (runtime.Value, error) {
 		return nil, err
 	}
 
+	if len(args) == 2 {
+		return vectorSortWith(name, call, vector, args[1])
+	}
+
 	if len(vector.Elements) == 0 {
 		return vector, nil
 	}
@@ -327,6 +349,154 @@ func vectorSort(args ...runtime.Value) (runtime.Value, error) {
 	return vector, nil
 }
 
+// vectorSortWith sorts a vector in place with a `less` function, keeping the order of equal elements.
+func vectorSortWith(name string, call runtime.Caller, vector *runtime.Vector, less runtime.Value) (runtime.Value, error) {
+	if _, err := core.ExpectFunction(name, 1, less); err != nil {
+		return nil, err
+	}
+
+	var sortErr error
+
+	sort.SliceStable(vector.Elements, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+
+		var isLess bool
+
+		isLess, sortErr = callPredicate(name, call, less, vector.Elements[i], vector.Elements[j])
+
+		return isLess
+	})
+
+	if sortErr != nil {
+		return nil, sortErr
+	}
+
+	return vector, nil
+}
+
+// vectorMap implements the vector mapping function.
+// Usage: (vec:map (vector 1 2 3) (lambda (x) (* x 2))) => (2 4 6)
+func vectorMap(mem *runtime.Memory, call runtime.Caller, args ...runtime.Value) (runtime.Value, error) {
+	const name = "vec:map"
+
+	if err := core.ExpectArgs(name, 2, args); err != nil {
+		return nil, err
+	}
+
+	vector, err := core.ExpectVector(name, 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := core.ExpectFunction(name, 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mem.AllocElements(len(vector.Elements), len(vector.Elements)); err != nil {
+		return nil, err
+	}
+
+	elements := make([]runtime.Value, 0, len(vector.Elements))
+
+	for _, elem := range vector.Elements {
+		result, err := call(fn, elem)
+		if err != nil {
+			return nil, err
+		}
+
+		elements = append(elements, result)
+	}
+
+	return runtime.NewVector(elements), nil
+}
+
+// vectorFilter implements the vector filtering function.
+// Usage: (vec:filter (vector 1 2 3 4) (lambda (x) (> x 2))) => (3 4)
+func vectorFilter(mem *runtime.Memory, call runtime.Caller, args ...runtime.Value) (runtime.Value, error) {
+	const name = "vec:filter"
+
+	if err := core.ExpectArgs(name, 2, args); err != nil {
+		return nil, err
+	}
+
+	vector, err := core.ExpectVector(name, 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	predicate, err := core.ExpectFunction(name, 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var elements []runtime.Value
+
+	for _, elem := range vector.Elements {
+		keep, err := callPredicate(name, call, predicate, elem)
+		if err != nil {
+			return nil, err
+		}
+
+		if keep {
+			elements = append(elements, elem)
+		}
+	}
+
+	if err := mem.AllocElements(len(elements), len(elements)); err != nil {
+		return nil, err
+	}
+
+	return runtime.NewVector(elements), nil
+}
+
+// vectorReduce implements the vector folding function.
+// Usage: (vec:reduce (vector 1 2 3) (lambda (acc x) (+ acc x)) 0) => 6
+func vectorReduce(call runtime.Caller, args ...runtime.Value) (runtime.Value, error) {
+	const name = "vec:reduce"
+
+	if err := core.ExpectArgs(name, 3, args); err != nil {
+		return nil, err
+	}
+
+	vector, err := core.ExpectVector(name, 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := core.ExpectFunction(name, 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	acc := args[2]
+
+	for _, elem := range vector.Elements {
+		if acc, err = call(fn, acc, elem); err != nil {
+			return nil, err
+		}
+	}
+
+	return acc, nil
+}
+
+// callPredicate calls back a function that must return BOOL.
+func callPredicate(name string, call runtime.Caller, fn runtime.Value, args ...runtime.Value) (bool, error) {
+	result, err := call(fn, args...)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := result.(runtime.Bool)
+	if !ok {
+		return false, fmt.Errorf("`%s` expects the function to return BOOL, got %s", name, result.Type())
+	}
+
+	return b.Value, nil
+}
+
 func validateVectorIndex(name string, args []runtime.Value) (*runtime.Vector, int, error) {
 	vector, err := core.ExpectVector(name, 0, args[0])
 	if err != nil {
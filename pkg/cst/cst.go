@@ -0,0 +1,241 @@
+// Package cst provides the lossless Concrete Syntax Tree, keeping every token with its trivia so the source
+// can be rewritten byte for byte, e.g. by formatters, refactoring tools and documentation extractors.
+package cst
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/danielspk/tatu-lang/pkg/debug"
+	"github.com/danielspk/tatu-lang/pkg/location"
+	"github.com/danielspk/tatu-lang/pkg/token"
+)
+
+// Node represents a node of the tree: an Atom or a List.
+type Node interface {
+	// Location returns the location of the node, without its trivia.
+	Location() location.Location
+	// Leading returns the trivia before the node, e.g. its documentation comments.
+	Leading() []token.Trivia
+	// String returns the source of the node with its trivia.
+	String() string
+
+	write(sb *strings.Builder)
+}
+
+// Atom represents a number, string, bool, nil or symbol token.
+type Atom struct {
+	Token token.Token
+}
+
+// Location returns the atom location.
+func (a *Atom) Location() location.Location {
+	return a.Token.Location
+}
+
+// Leading returns the trivia before the atom.
+func (a *Atom) Leading() []token.Trivia {
+	return a.Token.Leading
+}
+
+// String returns the source of the atom.
+func (a *Atom) String() string {
+	var sb strings.Builder
+	a.write(&sb)
+
+	return sb.String()
+}
+
+// write writes the source of the atom.
+func (a *Atom) write(sb *strings.Builder) {
+	writeToken(sb, a.Token)
+}
+
+// List represents the nodes between a pair of parens.
+type List struct {
+	Open  token.Token
+	Nodes []Node
+	Close token.Token
+}
+
+// Location returns the list location, from the open paren to the close paren.
+func (l *List) Location() location.Location {
+	return location.NewLocation(l.Open.File, l.Open.Start, l.Close.End)
+}
+
+// Leading returns the trivia before the open paren.
+func (l *List) Leading() []token.Trivia {
+	return l.Open.Leading
+}
+
+// String returns the source of the list.
+func (l *List) String() string {
+	var sb strings.Builder
+	l.write(&sb)
+
+	return sb.String()
+}
+
+// write writes the source of the list.
+func (l *List) write(sb *strings.Builder) {
+	writeToken(sb, l.Open)
+
+	for _, node := range l.Nodes {
+		node.write(sb)
+	}
+
+	writeToken(sb, l.Close)
+}
+
+// Tree represents the tree of a source: its top-level nodes and the EOF token holding the trivia at its end.
+type Tree struct {
+	Nodes []Node
+	EOF   token.Token
+}
+
+// String returns the source of the tree.
+func (t *Tree) String() string {
+	var sb strings.Builder
+
+	for _, node := range t.Nodes {
+		node.write(&sb)
+	}
+
+	writeToken(&sb, t.EOF)
+
+	return sb.String()
+}
+
+// Doc returns the documentation of a node: the text of the comments right before it, without a blank line
+// in between, e.g. "Adds two numbers." for `; Adds two numbers.` followed by a `def`.
+func Doc(node Node) string {
+	var lines []string
+
+	// the leading trivia starts at the start of a line
+	blank := true
+
+	for _, trivia := range node.Leading() {
+		switch trivia.Kind {
+		case token.CommentTrivia:
+			lines = append(lines, strings.TrimSpace(strings.TrimLeft(trivia.Text, ";")))
+			blank = false
+		case token.NewlineTrivia:
+			// a blank line ends the previous comments
+			if blank {
+				lines = nil
+			}
+
+			blank = true
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// writeToken writes the source of a token with its trivia.
+func writeToken(sb *strings.Builder, tok token.Token) {
+	for _, trivia := range tok.Leading {
+		sb.WriteString(trivia.Text)
+	}
+
+	sb.WriteString(tok.Lexeme)
+
+	for _, trivia := range tok.Trailing {
+		sb.WriteString(trivia.Text)
+	}
+}
+
+// Parser is responsible for building the concrete syntax tree from the tokens of a scanner.WithTrivia scanner.
+// The tree is lossless as long as the tokens hold their trivia.
+type Parser struct {
+	current int
+	tokens  []token.Token
+}
+
+// NewParser builds a new Parser.
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// Parse parses the tokens and generates a resulting tree.
+func (p *Parser) Parse(tokens []token.Token) (*Tree, error) {
+	if len(tokens) == 0 || tokens[len(tokens)-1].Type != token.EOF {
+		return nil, fmt.Errorf("no tokens found")
+	}
+
+	p.current = 0
+	p.tokens = tokens
+
+	var nodes []Node
+
+	for p.peek().Type != token.EOF {
+		node, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return &Tree{Nodes: nodes, EOF: p.peek()}, nil
+}
+
+// peek returns the current token.
+func (p *Parser) peek() token.Token {
+	return p.tokens[p.current]
+}
+
+// advance returns the current token and advances one position.
+func (p *Parser) advance() token.Token {
+	tok := p.tokens[p.current]
+	p.current++
+
+	return tok
+}
+
+// parseNode parses an atom or a list.
+func (p *Parser) parseNode() (Node, error) {
+	tok := p.peek()
+
+	switch tok.Type {
+	case token.LeftParen:
+		return p.parseList()
+	case token.Number, token.String, token.Bool, token.Nil, token.Symbol:
+		return &Atom{Token: p.advance()}, nil
+	}
+
+	return nil, p.error("expected expression", tok.Location)
+}
+
+// parseList parses the nodes between a pair of parens.
+func (p *Parser) parseList() (Node, error) {
+	list := &List{Open: p.advance()}
+
+	for p.peek().Type != token.RightParen {
+		if p.peek().Type == token.EOF {
+			return nil, p.error("unclosed parenthesis", list.Open.Location)
+		}
+
+		node, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+
+		list.Nodes = append(list.Nodes, node)
+	}
+
+	list.Close = p.advance()
+
+	return list, nil
+}
+
+// error makes an error.
+func (p *Parser) error(msg string, loc location.Location) *debug.Error {
+	return &debug.Error{
+		Msg:      msg,
+		Line:     loc.End.Line,
+		Column:   loc.End.Column,
+		File:     loc.File,
+		Location: loc,
+	}
+}
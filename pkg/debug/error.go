@@ -3,14 +3,17 @@ package debug
 
 import (
 	"fmt"
+
+	"github.com/danielspk/tatu-lang/pkg/location"
 )
 
 // Error represent a Tatu error.
 type Error struct {
-	Msg    string
-	Line   uint
-	Column uint
-	File   string
+	Msg      string
+	Line     uint
+	Column   uint
+	File     string
+	Location location.Location // source range of the error, ending at Line and Column, zero when unknown
 }
 
 // Error shows the error message.
@@ -0,0 +1,57 @@
+package debug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Limit identifies an execution limit.
+type Limit int
+
+// Execution limits.
+const (
+	StepLimit     Limit = iota // budget of evaluation steps or instructions
+	DeadlineLimit              // wall-clock deadline of the context
+	CancelLimit                // cancellation of the context
+	MemoryLimit                // caps on string lengths, collection sizes and allocations
+)
+
+// LimitError reports an evaluation stopped by an execution limit at the given location.
+type LimitError struct {
+	Limit  Limit
+	Msg    string
+	Line   uint
+	Column uint
+	File   string
+	Err    error // context error of the deadline and cancellation limits
+}
+
+// NewContextLimitError builds the limit error of a done context.
+func NewContextLimitError(err error) *LimitError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &LimitError{Limit: DeadlineLimit, Msg: "execution deadline exceeded", Err: err}
+	}
+
+	return &LimitError{Limit: CancelLimit, Msg: "execution canceled", Err: err}
+}
+
+// NewStepLimitError builds the limit error of an exhausted step budget.
+func NewStepLimitError(budget int) *LimitError {
+	return &LimitError{Limit: StepLimit, Msg: fmt.Sprintf("step budget of %d exceeded", budget)}
+}
+
+// NewMemoryLimitError builds the limit error of a breached memory cap.
+func NewMemoryLimitError(msg string) *LimitError {
+	return &LimitError{Limit: MemoryLimit, Msg: msg}
+}
+
+// Error shows the error message.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("[Line %d][Column %d] Error: %s", e.Line, e.Column, e.Msg)
+}
+
+// Unwrap returns the context error, so `errors.Is(err, context.DeadlineExceeded)` holds.
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,289 @@
+// Package formatter rewrites source code in the canonical layout, keeping its comments.
+package formatter
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/danielspk/tatu-lang/pkg/ast"
+	"github.com/danielspk/tatu-lang/pkg/parser"
+	"github.com/danielspk/tatu-lang/pkg/scanner"
+	"github.com/danielspk/tatu-lang/pkg/token"
+)
+
+const (
+	defaultLineWidth = 80
+	indentWidth      = 2
+)
+
+// form represents the layout of a list that does not fit in a line.
+type form struct {
+	header int  // elements kept on the line of the head, the rest go on their own lines
+	keep   bool // the rest keep the lines they were written in, unless the list was written in a single line
+	align  bool // the rest are aligned with the first element after the head instead of indented
+	pairs  bool // the rest go two per line, e.g. the keys and values of a map
+}
+
+// forms are the layouts of the special forms, e.g. `(def name (params)` followed by the indented body.
+var forms = map[string]form{
+	"def":     {header: 2},
+	"macro":   {header: 2},
+	"lambda":  {header: 1},
+	"if":      {header: 1},
+	"while":   {header: 1},
+	"for":     {header: 3},
+	"var":     {header: 1, keep: true},
+	"set":     {header: 1, keep: true},
+	"include": {header: 1},
+	"block":   {header: 0},
+	"switch":  {header: 1, align: true},
+	"map":     {header: 0, keep: true, pairs: true},
+}
+
+// Formatter formats source code:
+//   - a list written in a single line stays in a single line while it fits in the line width,
+//   - otherwise the special forms keep their header on the first line (e.g. `(if cond`, `(def name (params)`)
+//     and the rest of their elements go on their own lines, indented by two spaces from the start of the line,
+//   - the `switch` clauses are aligned with the first one,
+//   - function calls, `var`, `set` and `map` keep the lines their elements were written in; when written in a
+//     single line, the arguments go on their own lines and the `map` keys and values go in pairs,
+//   - comments, atoms and single blank lines are kept as written.
+type Formatter struct {
+	scanner *scanner.Scanner
+	parser  *parser.Parser
+	width   int
+}
+
+// Option configures a Formatter.
+type Option func(f *Formatter)
+
+// WithLineWidth sets the width of the lines that single-line lists must fit in (80 by default).
+func WithLineWidth(width int) Option {
+	return func(f *Formatter) {
+		f.width = width
+	}
+}
+
+// NewFormatter builds a new Formatter.
+func NewFormatter(opts ...Option) *Formatter {
+	f := &Formatter{
+		scanner: scanner.NewScanner(scanner.WithTrivia()),
+		parser:  parser.NewParser(parser.WithoutSugar()),
+		width:   defaultLineWidth,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// Format formats a source, failing on its scanning and parsing errors.
+func (f *Formatter) Format(source []byte, filename string) ([]byte, error) {
+	tokens, err := f.scanner.Scan(source, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []token.Trivia
+
+	for _, tok := range tokens {
+		for _, trivia := range slices.Concat(tok.Leading, tok.Trailing) {
+			if trivia.Kind == token.CommentTrivia {
+				comments = append(comments, trivia)
+			}
+		}
+	}
+
+	program, err := f.parser.Parse(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &printer{source: string(source), comments: comments, width: f.width}
+	p.program(program.Program)
+
+	return []byte(p.out.String()), nil
+}
+
+// printer writes the layout of a program.
+type printer struct {
+	source   string
+	comments []token.Trivia // comments not printed yet
+	width    int
+	out      strings.Builder
+	column   int  // output column of the next character
+	indent   int  // indent of the current output line
+	line     uint // source line of the last printed expression or comment
+}
+
+// program prints the top-level expressions, each one on its own line.
+func (p *printer) program(program []ast.SExpr) {
+	for _, expr := range program {
+		loc := expr.Location()
+		p.printComments(loc.Start.Offset, 0)
+
+		if p.out.Len() > 0 {
+			p.newline(0, loc.Start.Line > p.line+1)
+		}
+
+		p.expr(expr)
+		p.line = loc.End.Line
+	}
+
+	p.printComments(math.MaxUint, 0)
+
+	if p.out.Len() > 0 {
+		p.write("\n")
+	}
+}
+
+// expr prints an expression at the current column.
+func (p *printer) expr(expr ast.SExpr) {
+	list, ok := expr.(*ast.ListExpr)
+	if !ok {
+		p.write(p.lexeme(expr))
+		return
+	}
+
+	if flat, ok := p.flat(list); ok && p.column+utf8.RuneCountInString(flat) <= p.width {
+		p.write(flat)
+		return
+	}
+
+	p.list(list)
+}
+
+// list prints a list over several lines.
+func (p *printer) list(list *ast.ListExpr) {
+	layout := p.layout(list)
+	indent := p.indent + indentWidth
+	multiline := list.Location().Start.Line != list.Location().End.Line
+
+	p.write("(")
+	p.line = list.Location().Start.Line
+
+	for i, elem := range list.List {
+		loc := elem.Location()
+		commented := p.printComments(loc.Start.Offset, indent)
+
+		switch {
+		case commented:
+			p.newline(indent, loc.Start.Line > p.line+1)
+		case i == 0:
+		case i <= layout.header:
+			p.write(" ")
+
+			if layout.align && i == 1 {
+				indent = p.column
+			}
+		case layout.keep && multiline && loc.Start.Line == p.line:
+			p.write(" ")
+		case layout.pairs && !multiline && (i-layout.header)%2 == 0:
+			p.write(" ")
+		default:
+			p.newline(indent, loc.Start.Line > p.line+1)
+		}
+
+		p.expr(elem)
+		p.line = loc.End.Line
+	}
+
+	if p.printComments(list.Location().End.Offset, indent) {
+		p.newline(indent, false)
+	}
+
+	p.write(")")
+}
+
+// layout returns the layout of a list: the one of its special form or the one of a call.
+func (p *printer) layout(list *ast.ListExpr) form {
+	if len(list.List) > 0 {
+		if head, ok := list.List[0].(*ast.SymbolExpr); ok {
+			if layout, ok := forms[head.Symbol]; ok {
+				return layout
+			}
+		}
+	}
+
+	return form{keep: true}
+}
+
+// flat returns the single-line layout of an expression written in a single line.
+func (p *printer) flat(expr ast.SExpr) (string, bool) {
+	loc := expr.Location()
+
+	if loc.Start.Line != loc.End.Line {
+		return "", false
+	}
+
+	list, ok := expr.(*ast.ListExpr)
+	if !ok {
+		return p.lexeme(expr), true
+	}
+
+	// a comment runs until the end of its line, so lists written in a single line have none
+	elems := make([]string, len(list.List))
+
+	for i, elem := range list.List {
+		elems[i], _ = p.flat(elem)
+	}
+
+	return "(" + strings.Join(elems, " ") + ")", true
+}
+
+// printComments prints the comments before an offset, each one on its own line at the indent unless it follows
+// an expression on its line. It reports whether any was printed.
+func (p *printer) printComments(before uint, indent int) bool {
+	printed := false
+
+	for len(p.comments) > 0 && p.comments[0].Start.Offset < before {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+
+		switch {
+		case p.out.Len() == 0:
+		case comment.Start.Line == p.line:
+			p.write(" ")
+		default:
+			p.newline(indent, comment.Start.Line > p.line+1)
+		}
+
+		p.write(comment.Text)
+		p.line = comment.End.Line
+		printed = true
+	}
+
+	return printed
+}
+
+// newline starts a new line at an indent, optionally after a blank line.
+func (p *printer) newline(indent int, blank bool) {
+	if blank {
+		p.out.WriteString("\n")
+	}
+
+	p.write("\n" + strings.Repeat(" ", indent))
+	p.indent = indent
+}
+
+// write writes text, tracking the column.
+func (p *printer) write(text string) {
+	p.out.WriteString(text)
+
+	if idx := strings.LastIndexByte(text, '\n'); idx >= 0 {
+		p.column = utf8.RuneCountInString(text[idx+1:])
+	} else {
+		p.column += utf8.RuneCountInString(text)
+	}
+}
+
+// lexeme returns an atom as written in the source.
+func (p *printer) lexeme(expr ast.SExpr) string {
+	loc := expr.Location()
+
+	return p.source[loc.Start.Offset:loc.End.Offset]
+}
@@ -2,40 +2,79 @@
 package interpreter
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/danielspk/tatu-lang/pkg/ast"
-	"github.com/danielspk/tatu-lang/pkg/core/builtins"
-	"github.com/danielspk/tatu-lang/pkg/core/stdlib"
+	"github.com/danielspk/tatu-lang/pkg/core"
+	"github.com/danielspk/tatu-lang/pkg/core/profile"
 	"github.com/danielspk/tatu-lang/pkg/debug"
 	"github.com/danielspk/tatu-lang/pkg/location"
 	"github.com/danielspk/tatu-lang/pkg/runtime"
 )
 
+// checkInterval is the number of steps between checks of the evaluation context.
+const checkInterval = 256
+
 // Interpreter represents a tree-walking interpreter.
 type Interpreter struct {
-	global *runtime.Environment
+	global    *runtime.Environment
+	modules   []runtime.Module
+	stepLimit int
+	timeout   time.Duration
+	ctx       context.Context
+	steps     int
+	running   bool // an evaluation is in progress
+}
+
+// Option configures an Interpreter.
+type Option func(i *Interpreter)
+
+// WithStepLimit limits the number of evaluation steps of each call to Eval or EvalProgram.
+func WithStepLimit(steps int) Option {
+	return func(i *Interpreter) {
+		i.stepLimit = steps
+	}
+}
+
+// WithTimeout limits the wall-clock duration of each call to Eval or EvalProgram.
+func WithTimeout(timeout time.Duration) Option {
+	return func(i *Interpreter) {
+		i.timeout = timeout
+	}
+}
+
+// WithMemoryLimits caps the strings and collections a script can build and its total allocation per evaluation.
+func WithMemoryLimits(limits runtime.MemoryLimits) Option {
+	return func(i *Interpreter) {
+		i.global.Memory().SetLimits(limits)
+	}
+}
+
+// WithModules registers only the given modules in the global scope instead of every one (profile.Full),
+// e.g. `WithModules(profile.Pure()...)` to deny file system access.
+func WithModules(modules ...runtime.Module) Option {
+	return func(i *Interpreter) {
+		i.modules = modules
+	}
 }
 
 // NewInterpreter builds a new Interpreter.
-func NewInterpreter() *Interpreter {
-	global := runtime.NewEnvironment(nil, nil)
+func NewInterpreter(opts ...Option) *Interpreter {
+	i := &Interpreter{
+		global:  runtime.NewEnvironment(nil, nil),
+		modules: profile.Full(),
+	}
 
-	builtins.RegisterArithmetic(global)
-	builtins.RegisterComparison(global)
-	builtins.RegisterIO(global)
-	builtins.RegisterTypes(global)
+	for _, opt := range opts {
+		opt(i)
+	}
 
-	stdlib.RegisterFileSystem(global)
-	stdlib.RegisterJSON(global)
-	stdlib.RegisterMap(global)
-	stdlib.RegisterMath(global)
-	stdlib.RegisterRegex(global)
-	stdlib.RegisterString(global)
-	stdlib.RegisterTime(global)
-	stdlib.RegisterVector(global)
+	profile.Register(i.global, i.modules)
 
-	return &Interpreter{global: global}
+	return i
 }
 
 // Globals returns the user-defined global variables.
@@ -43,14 +82,43 @@ func (i *Interpreter) Globals() map[string]runtime.Value {
 	return i.global.Variables()
 }
 
+// Natives returns the runtime-provided global bindings, e.g. the builtins and the standard library.
+func (i *Interpreter) Natives() map[string]runtime.Value {
+	return i.global.Natives()
+}
+
+// Register defines a Go function as a native in the global scope, converting its arguments and result
+// between Tatu values and Go values (see core.NewGoFunction), e.g. `Register("http:get", httpGet)`.
+func (i *Interpreter) Register(name string, fn any) error {
+	return core.RegisterGoFunction(i.global, name, fn)
+}
+
 // Eval evaluates an S-expression and returns the resulting value.
 // Note: the format of the S-expressions is guaranteed by the syntax analyzer.
 func (i *Interpreter) Eval(expr ast.SExpr, env *runtime.Environment) (runtime.Value, error) {
+	return i.EvalContext(context.Background(), expr, env)
+}
+
+// EvalContext evaluates an S-expression until it finishes, the context is done or an execution limit is hit.
+// Stopped evaluations return a *debug.LimitError.
+func (i *Interpreter) EvalContext(ctx context.Context, expr ast.SExpr, env *runtime.Environment) (runtime.Value, error) {
+	cancel := i.start(ctx)
+	defer cancel()
+
 	return i.eval(expr, env)
 }
 
 // EvalProgram evaluates an AST and returns the resulting value.
 func (i *Interpreter) EvalProgram(ast *ast.AST, env *runtime.Environment) (runtime.Value, error) {
+	return i.EvalProgramContext(context.Background(), ast, env)
+}
+
+// EvalProgramContext evaluates an AST until it finishes, the context is done or an execution limit is hit.
+// Stopped evaluations return a *debug.LimitError.
+func (i *Interpreter) EvalProgramContext(ctx context.Context, ast *ast.AST, env *runtime.Environment) (runtime.Value, error) {
+	cancel := i.start(ctx)
+	defer cancel()
+
 	var lastValue runtime.Value
 	var err error
 
@@ -64,6 +132,83 @@ func (i *Interpreter) EvalProgram(ast *ast.AST, env *runtime.Environment) (runti
 	return lastValue, nil
 }
 
+// Call calls a function value, e.g. a lambda taken from Globals, with the given arguments and returns its result.
+// Errors raised inside the function keep their source location.
+func (i *Interpreter) Call(fn runtime.Value, args ...runtime.Value) (runtime.Value, error) {
+	return i.CallContext(context.Background(), fn, args...)
+}
+
+// CallContext calls a function value until it returns, the context is done or an execution limit is hit.
+// Stopped calls return a *debug.LimitError. A call made while an evaluation is running, e.g. from a registered
+// Go function, is nested in it: it shares its limits and ignores ctx.
+func (i *Interpreter) CallContext(ctx context.Context, fn runtime.Value, args ...runtime.Value) (runtime.Value, error) {
+	var loc location.Location
+
+	switch fn := fn.(type) {
+	case runtime.Function:
+		loc = fn.Params.Location()
+	case runtime.NativeFunction:
+	case nil:
+		return nil, i.error("cannot call nil: value is not a function", loc)
+	default:
+		return nil, i.error(fmt.Sprintf("cannot call %s: value is not a function", fn.Type()), loc)
+	}
+
+	cancel := i.start(ctx)
+	defer cancel()
+
+	return i.apply(fn, args, loc)
+}
+
+// CallGlobal calls the function bound to a name in the global scope, e.g. `CallGlobal("on-event", event)`.
+func (i *Interpreter) CallGlobal(name string, args ...runtime.Value) (runtime.Value, error) {
+	fn, found := i.global.Lookup(name)
+	if !found {
+		return nil, i.error(fmt.Sprintf("unknown symbol `%s`", name), location.Location{})
+	}
+
+	return i.Call(fn, args...)
+}
+
+// start resets the execution limits for a new evaluation. Nested evaluations, e.g. a Call from a registered Go
+// function, run within the limits and the memory accounting of the outer one, ignoring their own context.
+func (i *Interpreter) start(ctx context.Context) context.CancelFunc {
+	if i.running {
+		return func() {}
+	}
+
+	cancel := context.CancelFunc(func() {})
+
+	if i.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, i.timeout)
+	}
+
+	i.ctx, i.steps, i.running = ctx, 0, true
+	i.global.Memory().Reset()
+
+	return func() {
+		cancel()
+		i.running = false
+	}
+}
+
+// step counts an evaluation step, checking the execution limits.
+func (i *Interpreter) step(loc location.Location) error {
+	i.steps++
+
+	if i.stepLimit > 0 && i.steps > i.stepLimit {
+		return i.limitError(debug.NewStepLimitError(i.stepLimit), loc)
+	}
+
+	if i.steps%checkInterval == 0 && i.ctx != nil {
+		if err := i.ctx.Err(); err != nil {
+			return i.limitError(debug.NewContextLimitError(err), loc)
+		}
+	}
+
+	return nil
+}
+
 // eval evaluates an S-expression in non-tail position.
 func (i *Interpreter) eval(expr ast.SExpr, env *runtime.Environment) (runtime.Value, error) {
 	result, err := i.evalInTailPosition(expr, env)
@@ -84,6 +229,10 @@ func (i *Interpreter) evalInTailPosition(expr ast.SExpr, env *runtime.Environmen
 		env = i.global
 	}
 
+	if err := i.step(expr.Location()); err != nil {
+		return nil, err
+	}
+
 	switch expr.(type) {
 	case *ast.NumberExpr, *ast.StringExpr, *ast.BoolExpr, *ast.NilExpr, *ast.SymbolExpr:
 		return i.evalAtom(expr, env)
@@ -336,6 +485,10 @@ func (i *Interpreter) evalRecur(expr ast.SExpr, env *runtime.Environment) (runti
 func (i *Interpreter) evalVector(expr ast.SExpr, env *runtime.Environment) (runtime.Value, error) {
 	exprList := expr.(*ast.ListExpr)
 
+	if err := i.global.Memory().AllocElements(len(exprList.List)-1, len(exprList.List)-1); err != nil {
+		return nil, i.nativeError(err, exprList.Location())
+	}
+
 	elements := make([]runtime.Value, 0, len(exprList.List)-1)
 
 	for _, e := range exprList.List[1:] {
@@ -354,6 +507,10 @@ func (i *Interpreter) evalVector(expr ast.SExpr, env *runtime.Environment) (runt
 func (i *Interpreter) evalMap(expr ast.SExpr, env *runtime.Environment) (runtime.Value, error) {
 	exprList := expr.(*ast.ListExpr)
 
+	if err := i.global.Memory().AllocElements((len(exprList.List)-1)/2, (len(exprList.List)-1)/2); err != nil {
+		return nil, i.nativeError(err, exprList.Location())
+	}
+
 	elements := make(map[string]runtime.Value, (len(exprList.List)-1)/2)
 
 	for idx := 1; idx < len(exprList.List); idx += 2 {
@@ -398,11 +555,23 @@ func (i *Interpreter) evalCallFunction(expr ast.SExpr, env *runtime.Environment)
 		return nil, err
 	}
 
+	return i.apply(funcValue, valArgs, exprList.Location())
+}
+
+// apply calls a native or lambda function with evaluated arguments, reporting call errors at the given location.
+// Lambda bodies are evaluated in tail position, running `recur` in constant stack space.
+func (i *Interpreter) apply(funcValue runtime.Value, args []runtime.Value, loc location.Location) (runtime.Value, error) {
 	// native function
-	if funcValue.Type() == runtime.NativeFuncType {
-		result, err := funcValue.(runtime.NativeFunction).Value(valArgs...)
+	if native, ok := funcValue.(runtime.NativeFunction); ok {
+		var call runtime.Caller
+
+		if native.Callback != nil {
+			call = i.caller(loc)
+		}
+
+		result, err := native.Call(call, args...)
 		if err != nil {
-			return nil, i.error(err.Error(), exprList.Location())
+			return nil, i.nativeError(err, loc)
 		}
 
 		return result, nil
@@ -416,11 +585,11 @@ func (i *Interpreter) evalCallFunction(expr ast.SExpr, env *runtime.Environment)
 	activationEnv := runtime.NewEnvironment(activationRecord, fn.Env)
 
 	expectedArgs := len(params)
-	currentArgs := valArgs
+	currentArgs := args
 
 	for {
 		if len(currentArgs) != expectedArgs {
-			return nil, i.error(fmt.Sprintf("expected %d arguments, got %d", expectedArgs, len(currentArgs)), exprList.Location())
+			return nil, i.error(fmt.Sprintf("expected %d arguments, got %d", expectedArgs, len(currentArgs)), loc)
 		}
 
 		clear(activationRecord)
@@ -444,6 +613,21 @@ func (i *Interpreter) evalCallFunction(expr ast.SExpr, env *runtime.Environment)
 	}
 }
 
+// caller builds the Caller natives use to call back functions, reporting call errors at the location of the native call.
+func (i *Interpreter) caller(loc location.Location) runtime.Caller {
+	return func(fn runtime.Value, args ...runtime.Value) (runtime.Value, error) {
+		if fn == nil {
+			return nil, i.error("cannot call nil: value is not a function", loc)
+		}
+
+		if fn.Type() != runtime.FuncType && fn.Type() != runtime.NativeFuncType {
+			return nil, i.error(fmt.Sprintf("cannot call %s: value is not a function", fn.Type()), loc)
+		}
+
+		return i.apply(fn, args, loc)
+	}
+}
+
 // evalFunctionArguments evaluates a list of argument expressions.
 func (i *Interpreter) evalFunctionArguments(exprArgs []ast.SExpr, env *runtime.Environment) ([]runtime.Value, error) {
 	results := make([]runtime.Value, 0, len(exprArgs))
@@ -460,12 +644,40 @@ func (i *Interpreter) evalFunctionArguments(exprArgs []ast.SExpr, env *runtime.E
 	return results, nil
 }
 
+// nativeError locates an error of a native function or an allocation, keeping limit errors distinguishable.
+// Errors of the functions called back by the native are already located.
+func (i *Interpreter) nativeError(err error, loc location.Location) error {
+	if tatuErr, ok := err.(*debug.Error); ok {
+		return tatuErr
+	}
+
+	var limitErr *debug.LimitError
+
+	if errors.As(err, &limitErr) {
+		if limitErr.Line > 0 {
+			return limitErr
+		}
+
+		return i.limitError(limitErr, loc)
+	}
+
+	return i.error(err.Error(), loc)
+}
+
+// limitError locates a limit error.
+func (i *Interpreter) limitError(err *debug.LimitError, loc location.Location) *debug.LimitError {
+	err.Line, err.Column, err.File = loc.End.Line, loc.End.Column, loc.File
+
+	return err
+}
+
 // error makes an error.
 func (i *Interpreter) error(msg string, loc location.Location) *debug.Error {
 	return &debug.Error{
-		Msg:    msg,
-		Line:   loc.End.Line,
-		Column: loc.End.Column,
-		File:   loc.File,
+		Msg:      msg,
+		Line:     loc.End.Line,
+		Column:   loc.End.Column,
+		File:     loc.File,
+		Location: loc,
 	}
 }
@@ -0,0 +1,345 @@
+package lsp
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danielspk/tatu-lang/pkg/builder"
+	"github.com/danielspk/tatu-lang/pkg/cst"
+	"github.com/danielspk/tatu-lang/pkg/location"
+	"github.com/danielspk/tatu-lang/pkg/scanner"
+	"github.com/danielspk/tatu-lang/pkg/token"
+)
+
+// symbolKind represents the kind of binding of a symbol.
+type symbolKind int
+
+const (
+	variableSymbol symbolKind = iota
+	functionSymbol
+	parameterSymbol
+	macroSymbol
+)
+
+// symbol represents a binding defined by a `var`, `def`, `lambda`, `for` or `macro` expression.
+type symbol struct {
+	name   string
+	kind   symbolKind
+	loc    location.Location // location of the bound name
+	global bool              // defined at the top level, visible from the whole program
+	from   uint              // offset where a local symbol starts to be visible
+	to     uint              // offset where a local symbol stops to be visible
+	detail string            // header of the defining expression, e.g. `(def add (a b))`
+	doc    string
+	file   string // file the symbol is defined in
+}
+
+// visible checks if the symbol can be referenced at an offset of its file.
+func (s *symbol) visible(offset uint) bool {
+	return s.global || s.from <= offset && offset <= s.to
+}
+
+// scope represents the range of a source where the bindings of an expression are visible.
+type scope struct {
+	global bool
+	to     uint
+}
+
+// index holds the bindings, the includes and the symbol references of a source.
+type index struct {
+	file     string
+	symbols  []*symbol
+	includes []string    // absolute paths of the included files
+	atoms    []*cst.Atom // symbol atoms, sorted by offset
+}
+
+// newIndex builds the index of a source, failing when the source is not well-formed.
+func newIndex(source []byte, file string) (*index, error) {
+	tokens, err := scanner.NewScanner(scanner.WithTrivia()).Scan(source, file)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := cst.NewParser().Parse(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	ix := &index{file: file}
+
+	for _, node := range tree.Nodes {
+		ix.walk(node, scope{global: true})
+	}
+
+	// the names of bindings are indexed out of order
+	sort.Slice(ix.atoms, func(i, j int) bool {
+		return ix.atoms[i].Token.Start.Offset < ix.atoms[j].Token.Start.Offset
+	})
+
+	return ix, nil
+}
+
+// walk indexes a node and its children.
+func (ix *index) walk(node cst.Node, sc scope) {
+	if atom, ok := node.(*cst.Atom); ok {
+		if atom.Token.Type == token.Symbol {
+			ix.atoms = append(ix.atoms, atom)
+		}
+
+		return
+	}
+
+	list := node.(*cst.List)
+	end := list.Close.End.Offset
+
+	switch headSymbol(list) {
+	case "var":
+		// the value is evaluated before the name is bound
+		if name, ok := nodeAt(list, 1); ok {
+			ix.define(name, variableSymbol, sc, end, header(list, 2), cst.Doc(list))
+		}
+	case "def":
+		if name, ok := nodeAt(list, 1); ok {
+			// functions can call themselves
+			ix.define(name, functionSymbol, sc, name.Token.Start.Offset, header(list, 3), cst.Doc(list))
+		}
+
+		ix.walkFunction(list, 2, header(list, 3))
+
+		return
+	case "lambda":
+		ix.walkFunction(list, 1, header(list, 2))
+
+		return
+	case "macro":
+		if name, ok := nodeAt(list, 1); ok {
+			ix.define(name, macroSymbol, scope{global: true}, 0, header(list, 3), cst.Doc(list))
+		}
+
+		ix.walkFunction(list, 2, header(list, 3))
+
+		return
+	case "block":
+		ix.walkNodes(list.Nodes, 0, scope{to: end})
+
+		return
+	case "for":
+		// the init variable only lives in the loop
+		ix.walkNodes(list.Nodes, 0, scope{to: end})
+
+		return
+	case "include":
+		if sc.global && len(list.Nodes) == 2 {
+			if path, ok := list.Nodes[1].(*cst.Atom); ok && path.Token.Type == token.String {
+				ix.includes = append(ix.includes, builder.ResolvePath(ix.file, unquote(path.Token.Lexeme)))
+			}
+		}
+	}
+
+	ix.walkNodes(list.Nodes, 0, sc)
+}
+
+// walkNodes indexes the nodes of a list from a position.
+func (ix *index) walkNodes(nodes []cst.Node, from int, sc scope) {
+	for i := from; i < len(nodes); i++ {
+		ix.walk(nodes[i], sc)
+	}
+}
+
+// walkFunction indexes the params at a position of a list, visible in the whole list, and the following body.
+func (ix *index) walkFunction(list *cst.List, params int, detail string) {
+	sc := scope{to: list.Close.End.Offset}
+
+	// the head and the name
+	ix.walkNodes(list.Nodes[:min(len(list.Nodes), params)], 0, sc)
+
+	if paramList, ok := nodeAtList(list, params); ok {
+		for _, param := range paramList.Nodes {
+			if atom, ok := param.(*cst.Atom); ok && atom.Token.Type == token.Symbol && atom.Token.Lexeme != "..." {
+				ix.define(atom, parameterSymbol, sc, list.Open.Start.Offset, detail, "")
+				ix.atoms = append(ix.atoms, atom)
+			}
+		}
+	}
+
+	ix.walkNodes(list.Nodes, params+1, sc)
+}
+
+// define adds a symbol bound in a scope from an offset.
+func (ix *index) define(name *cst.Atom, kind symbolKind, sc scope, from uint, detail string, doc string) {
+	ix.symbols = append(ix.symbols, &symbol{
+		name:   name.Token.Lexeme,
+		kind:   kind,
+		loc:    name.Token.Location,
+		global: sc.global,
+		from:   from,
+		to:     sc.to,
+		detail: detail,
+		doc:    doc,
+		file:   ix.file,
+	})
+}
+
+// atomAt returns the symbol atom at an offset, including the offset right after it.
+func (ix *index) atomAt(offset uint) (*cst.Atom, bool) {
+	i := sort.Search(len(ix.atoms), func(i int) bool {
+		return ix.atoms[i].Token.End.Offset >= offset
+	})
+
+	if i < len(ix.atoms) && ix.atoms[i].Token.Start.Offset <= offset {
+		return ix.atoms[i], true
+	}
+
+	return nil, false
+}
+
+// lookup returns the symbol defined by the atom at an offset, else the innermost local symbol visible at the
+// offset, else the last global one defined before it.
+func (ix *index) lookup(name string, offset uint) (*symbol, bool) {
+	var found *symbol
+
+	for _, sym := range ix.symbols {
+		if sym.name == name && sym.loc.Start.Offset <= offset && offset <= sym.loc.End.Offset {
+			return sym, true
+		}
+	}
+
+	for _, sym := range ix.symbols {
+		if sym.name != name || sym.global || !sym.visible(offset) {
+			continue
+		}
+
+		if found == nil || sym.from >= found.from {
+			found = sym
+		}
+	}
+
+	if found != nil {
+		return found, true
+	}
+
+	for _, sym := range ix.symbols {
+		if sym.name == name && sym.global && (found == nil || sym.loc.Start.Offset <= offset) {
+			found = sym
+		}
+	}
+
+	return found, found != nil
+}
+
+// visibleSymbols returns the symbols visible at an offset, the inner ones first.
+func (ix *index) visibleSymbols(offset uint) []*symbol {
+	var symbols []*symbol
+
+	for _, sym := range ix.symbols {
+		if sym.visible(offset) {
+			symbols = append(symbols, sym)
+		}
+	}
+
+	sort.SliceStable(symbols, func(i, j int) bool {
+		if symbols[i].global != symbols[j].global {
+			return !symbols[i].global
+		}
+
+		return symbols[i].from > symbols[j].from
+	})
+
+	return symbols
+}
+
+// globals returns the symbols defined at the top level.
+func (ix *index) globals() []*symbol {
+	var symbols []*symbol
+
+	for _, sym := range ix.symbols {
+		if sym.global {
+			symbols = append(symbols, sym)
+		}
+	}
+
+	return symbols
+}
+
+// headSymbol returns the symbol at the head of a list.
+func headSymbol(list *cst.List) string {
+	if head, ok := nodeAt(list, 0); ok {
+		return head.Token.Lexeme
+	}
+
+	return ""
+}
+
+// nodeAt returns the symbol atom at a position of a list.
+func nodeAt(list *cst.List, i int) (*cst.Atom, bool) {
+	if i >= len(list.Nodes) {
+		return nil, false
+	}
+
+	atom, ok := list.Nodes[i].(*cst.Atom)
+
+	return atom, ok && atom.Token.Type == token.Symbol
+}
+
+// nodeAtList returns the list at a position of a list.
+func nodeAtList(list *cst.List, i int) (*cst.List, bool) {
+	if i >= len(list.Nodes) {
+		return nil, false
+	}
+
+	inner, ok := list.Nodes[i].(*cst.List)
+
+	return inner, ok
+}
+
+// header returns the first nodes of a list in a single line, e.g. `(def add (a b))`.
+func header(list *cst.List, n int) string {
+	var sb strings.Builder
+
+	sb.WriteByte('(')
+
+	for i, node := range list.Nodes[:min(len(list.Nodes), n)] {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+
+		writeCompact(&sb, node)
+	}
+
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+// writeCompact writes a node without its trivia.
+func writeCompact(sb *strings.Builder, node cst.Node) {
+	if atom, ok := node.(*cst.Atom); ok {
+		sb.WriteString(atom.Token.Lexeme)
+
+		return
+	}
+
+	list := node.(*cst.List)
+
+	sb.WriteByte('(')
+
+	for i, inner := range list.Nodes {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+
+		writeCompact(sb, inner)
+	}
+
+	sb.WriteByte(')')
+}
+
+// unquote returns the content of a string lexeme.
+func unquote(lexeme string) string {
+	if value, err := strconv.Unquote(lexeme); err == nil {
+		return value
+	}
+
+	return strings.Trim(lexeme, `"`)
+}
@@ -0,0 +1,230 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/danielspk/tatu-lang/pkg/location"
+)
+
+// LSP constants.
+const (
+	syncFull             = 1
+	severityError        = 1
+	completionFunction   = 3
+	completionVariable   = 6
+	completionKeyword    = 14
+	markupKindMarkdown   = "markdown"
+	diagnosticSourceName = "tatu"
+)
+
+// initializeResult represents the result of `initialize`.
+type initializeResult struct {
+	Capabilities serverCapabilities `json:"capabilities"`
+	ServerInfo   serverInfo         `json:"serverInfo"`
+}
+
+// serverCapabilities represents the features provided by the server.
+type serverCapabilities struct {
+	TextDocumentSync   int               `json:"textDocumentSync"`
+	DefinitionProvider bool              `json:"definitionProvider"`
+	HoverProvider      bool              `json:"hoverProvider"`
+	CompletionProvider completionOptions `json:"completionProvider"`
+}
+
+// completionOptions represents the options of the completion feature.
+type completionOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters"`
+}
+
+// serverInfo identifies the server.
+type serverInfo struct {
+	Name string `json:"name"`
+}
+
+// position represents a zero-based line and a character offset in UTF-16 code units.
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// textRange represents the range between two positions.
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+// documentLocation represents a range of a document.
+type documentLocation struct {
+	URI   string    `json:"uri"`
+	Range textRange `json:"range"`
+}
+
+// textDocumentIdentifier identifies a document.
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// textDocumentPositionParams represents a position in a document.
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+// didOpenParams represents the params of `textDocument/didOpen`.
+type didOpenParams struct {
+	TextDocument struct {
+		URI     string `json:"uri"`
+		Version int    `json:"version"`
+		Text    string `json:"text"`
+	} `json:"textDocument"`
+}
+
+// didChangeParams represents the params of `textDocument/didChange`, with the whole text in each change.
+type didChangeParams struct {
+	TextDocument struct {
+		URI     string `json:"uri"`
+		Version int    `json:"version"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+// didCloseParams represents the params of `textDocument/didClose`.
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+// diagnostic represents an error of a document.
+type diagnostic struct {
+	Range    textRange `json:"range"`
+	Severity int       `json:"severity"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+// publishDiagnosticsParams represents the params of `textDocument/publishDiagnostics`.
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     int          `json:"version"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+// markupContent represents a formatted text.
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// hover represents the result of `textDocument/hover`.
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range    textRange     `json:"range"`
+}
+
+// completionItem represents an item of the result of `textDocument/completion`.
+type completionItem struct {
+	Label         string         `json:"label"`
+	Kind          int            `json:"kind"`
+	Detail        string         `json:"detail,omitempty"`
+	Documentation *markupContent `json:"documentation,omitempty"`
+}
+
+// uriToPath converts a `file://` URI to a file path.
+func uriToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+
+	path := parsed.Path
+
+	// Windows paths look like `/C:/dir/file.tatu`
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+
+	return filepath.Clean(filepath.FromSlash(path))
+}
+
+// pathToURI converts a file path to a `file://` URI.
+func pathToURI(path string) string {
+	path = filepath.ToSlash(path)
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// toPosition converts a source position to a position of its text.
+func toPosition(text string, pos location.Position) position {
+	if pos.Line == 0 {
+		return position{}
+	}
+
+	// columns count runes from 1
+	column := uint(1)
+	character := 0
+
+	for _, r := range lineText(text, int(pos.Line)-1) {
+		if column >= pos.Column {
+			break
+		}
+
+		character += utf16.RuneLen(r)
+		column++
+	}
+
+	return position{Line: int(pos.Line) - 1, Character: character}
+}
+
+// toRange converts a source location to a range of its text.
+func toRange(text string, loc location.Location) textRange {
+	return textRange{Start: toPosition(text, loc.Start), End: toPosition(text, loc.End)}
+}
+
+// toOffset converts a position of a text to a byte offset.
+func toOffset(text string, pos position) uint {
+	offset := 0
+
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(text[offset:], '\n')
+		if next == -1 {
+			return uint(len(text))
+		}
+
+		offset += next + 1
+	}
+
+	for character := 0; offset < len(text) && text[offset] != '\n' && character < pos.Character; {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		character += utf16.RuneLen(r)
+		offset += size
+	}
+
+	return uint(offset)
+}
+
+// lineText returns a line of a text, without its newline.
+func lineText(text string, line int) string {
+	for ; line > 0; line-- {
+		next := strings.IndexByte(text, '\n')
+		if next == -1 {
+			return ""
+		}
+
+		text = text[next+1:]
+	}
+
+	if end := strings.IndexByte(text, '\n'); end != -1 {
+		text = text[:end]
+	}
+
+	return text
+}
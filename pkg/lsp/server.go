@@ -0,0 +1,518 @@
+// Package lsp implements a Language Server Protocol server over a stream, e.g. the standard input and output of
+// `tatu lsp`, reporting the errors of the program builder and resolving the bindings of the sources.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/danielspk/tatu-lang/pkg/builder"
+	"github.com/danielspk/tatu-lang/pkg/debug"
+	"github.com/danielspk/tatu-lang/pkg/interpreter"
+	"github.com/danielspk/tatu-lang/pkg/location"
+)
+
+// document represents a source opened by the client.
+type document struct {
+	uri     string
+	path    string
+	version int
+	text    string
+	index   *index // last index built without errors
+}
+
+// Server is responsible for answering the requests of a client about its open sources.
+type Server struct {
+	conn        *conn
+	inter       *interpreter.Interpreter
+	documents   map[string]*document // by path
+	initialized bool
+	shutdown    bool
+}
+
+// Option configures a Server.
+type Option func(s *Server)
+
+// WithInterpreter completes and describes the natives of an interpreter, e.g. one with registered Go functions.
+func WithInterpreter(inter *interpreter.Interpreter) Option {
+	return func(s *Server) {
+		s.inter = inter
+	}
+}
+
+// NewServer builds a new Server reading the requests from in and writing the responses to out.
+func NewServer(in io.Reader, out io.Writer, opts ...Option) *Server {
+	s := &Server{
+		conn:      newConn(in, out),
+		documents: make(map[string]*document),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.inter == nil {
+		s.inter = interpreter.NewInterpreter()
+	}
+
+	return s
+}
+
+// Run answers the requests until the `exit` notification, failing when the stream ends before it or when the
+// `exit` is not preceded by a `shutdown` request.
+func (s *Server) Run() error {
+	for {
+		content, err := s.conn.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("connection closed before the `exit` notification")
+			}
+
+			return err
+		}
+
+		var req request
+
+		if err := json.Unmarshal(content, &req); err != nil {
+			if err := s.reply(json.RawMessage("null"), nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("`exit` notification without a `shutdown` request")
+			}
+
+			return nil
+		}
+
+		result, err := s.handle(req)
+
+		// notifications have no response
+		if req.ID == nil {
+			continue
+		}
+
+		var rpcErr *responseError
+
+		if err != nil && !errors.As(err, &rpcErr) {
+			rpcErr = &responseError{Code: codeInvalidRequest, Message: err.Error()}
+		}
+
+		if err := s.reply(req.ID, result, rpcErr); err != nil {
+			return err
+		}
+	}
+}
+
+// handle dispatches a request or a notification.
+func (s *Server) handle(req request) (any, error) {
+	if !s.initialized && req.Method != "initialize" {
+		return nil, &responseError{Code: codeNotInitialized, Message: "server not initialized"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		s.initialized = true
+
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:   syncFull,
+				DefinitionProvider: true,
+				HoverProvider:      true,
+				CompletionProvider: completionOptions{TriggerCharacters: []string{":", "("}},
+			},
+			ServerInfo: serverInfo{Name: "tatu"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+
+		// the full sync sends the whole text in the last change
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Version, text)
+	case "textDocument/didClose":
+		var params didCloseParams
+
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		delete(s.documents, uriToPath(params.TextDocument.URI))
+
+		return nil, s.publish(params.TextDocument.URI, 0, []diagnostic{})
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		return s.definition(params), nil
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		return s.hover(params), nil
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		return s.completion(params), nil
+	}
+
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("unknown method `%s`", req.Method)}
+}
+
+// reply writes the response of a request.
+func (s *Server) reply(id json.RawMessage, result any, rpcErr *responseError) error {
+	resp := response{JSONRPC: "2.0", ID: id}
+
+	if rpcErr != nil {
+		resp.Error = rpcErr
+
+		return s.conn.write(resp)
+	}
+
+	content, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	resp.Result = content
+
+	return s.conn.write(resp)
+}
+
+// update stores the text of a document and publishes the diagnostics of every open document, as they can include it.
+func (s *Server) update(uri string, version int, text string) error {
+	path := uriToPath(uri)
+
+	doc, ok := s.documents[path]
+	if !ok {
+		doc = &document{uri: uri, path: path, index: &index{file: path}}
+		s.documents[path] = doc
+	}
+
+	doc.version = version
+	doc.text = text
+
+	// a source being edited keeps the bindings of its last well-formed text
+	if ix, err := newIndex([]byte(text), path); err == nil {
+		doc.index = ix
+	}
+
+	if err := s.diagnose(doc); err != nil {
+		return err
+	}
+
+	for _, other := range slices.Sorted(maps.Keys(s.documents)) {
+		if other != path {
+			if err := s.diagnose(s.documents[other]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// diagnose builds the program of a document and publishes its error.
+func (s *Server) diagnose(doc *document) error {
+	diagnostics := []diagnostic{}
+
+	pb := builder.NewProgramBuilderWithDefaults(builder.WithReadFile(s.readFile))
+
+	if _, _, err := pb.BuildFromSource([]byte(doc.text), doc.path); err != nil {
+		diagnostics = append(diagnostics, s.diagnostic(doc, err))
+	}
+
+	return s.publish(doc.uri, doc.version, diagnostics)
+}
+
+// diagnostic locates an error of the program of a document: on its source when it comes from the document,
+// otherwise on the `include` expression leading to the file with the error.
+func (s *Server) diagnostic(doc *document, err error) diagnostic {
+	diag := diagnostic{Severity: severityError, Source: diagnosticSourceName, Message: err.Error()}
+
+	var dbgErr *debug.Error
+
+	if errors.As(err, &dbgErr) && dbgErr.File == doc.path {
+		diag.Message = dbgErr.Msg
+		diag.Range = toRange(doc.text, dbgErr.Location)
+
+		if dbgErr.Location.Start.Line == 0 {
+			pos := toPosition(doc.text, location.NewPosition(dbgErr.Line, dbgErr.Column, 0))
+			diag.Range = textRange{Start: pos, End: pos}
+		}
+
+		return diag
+	}
+
+	// the outermost include leads from the document to the file with the error
+	var incErr *builder.IncludeError
+
+	if errors.As(err, &incErr) && incErr.IncludedBy == doc.path {
+		diag.Range = toRange(doc.text, incErr.Location)
+	}
+
+	return diag
+}
+
+// publish sends the diagnostics of a document.
+func (s *Server) publish(uri string, version int, diagnostics []diagnostic) error {
+	return s.conn.write(notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: uri, Version: version, Diagnostics: diagnostics},
+	})
+}
+
+// definition returns the location of the binding of the symbol at a position.
+func (s *Server) definition(params textDocumentPositionParams) any {
+	sym, ok := s.symbolAt(params)
+	if !ok {
+		return nil
+	}
+
+	return documentLocation{URI: pathToURI(sym.file), Range: toRange(s.text(sym.file), sym.loc)}
+}
+
+// hover describes the binding or the native of the symbol at a position.
+func (s *Server) hover(params textDocumentPositionParams) any {
+	doc, ok := s.documents[uriToPath(params.TextDocument.URI)]
+	if !ok {
+		return nil
+	}
+
+	atom, ok := doc.index.atomAt(toOffset(doc.text, params.Position))
+	if !ok {
+		return nil
+	}
+
+	var value string
+
+	if sym, ok := s.symbolAt(params); ok {
+		value = codeBlock(sym.detail) + paragraph(sym.doc)
+	} else if sig, ok := signatures[atom.Token.Lexeme]; ok {
+		value = codeBlock(sig.usage) + paragraph(sig.description)
+	} else if _, ok := s.inter.Natives()[atom.Token.Lexeme]; ok {
+		value = codeBlock(atom.Token.Lexeme) + paragraph("Native function")
+	} else {
+		return nil
+	}
+
+	return hover{
+		Contents: markupContent{Kind: markupKindMarkdown, Value: value},
+		Range:    toRange(doc.text, atom.Token.Location),
+	}
+}
+
+// completion lists the special forms, the natives and the symbols visible at a position.
+func (s *Server) completion(params textDocumentPositionParams) any {
+	items := []completionItem{}
+	seen := make(map[string]bool)
+
+	add := func(item completionItem) {
+		if !seen[item.Label] {
+			seen[item.Label] = true
+			items = append(items, item)
+		}
+	}
+
+	if doc, ok := s.documents[uriToPath(params.TextDocument.URI)]; ok {
+		symbols := doc.index.visibleSymbols(toOffset(doc.text, params.Position))
+
+		for _, inc := range s.included(doc.index) {
+			symbols = append(symbols, inc.globals()...)
+		}
+
+		for _, sym := range symbols {
+			item := completionItem{Label: sym.name, Kind: completionVariable, Detail: sym.detail}
+
+			if sym.kind == functionSymbol || sym.kind == macroSymbol {
+				item.Kind = completionFunction
+			}
+
+			if sym.doc != "" {
+				item.Documentation = &markupContent{Kind: markupKindMarkdown, Value: sym.doc}
+			}
+
+			add(item)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(s.inter.Natives())) {
+		item := completionItem{Label: name, Kind: completionFunction}
+
+		if sig, ok := signatures[name]; ok {
+			item.Detail = sig.usage
+			item.Documentation = &markupContent{Kind: markupKindMarkdown, Value: sig.description}
+		}
+
+		add(item)
+	}
+
+	for _, form := range specialForms {
+		add(completionItem{Label: form, Kind: completionKeyword})
+	}
+
+	return items
+}
+
+// symbolAt resolves the symbol at a position: a binding of the document, else a global of the included files.
+func (s *Server) symbolAt(params textDocumentPositionParams) (*symbol, bool) {
+	doc, ok := s.documents[uriToPath(params.TextDocument.URI)]
+	if !ok {
+		return nil, false
+	}
+
+	offset := toOffset(doc.text, params.Position)
+
+	atom, ok := doc.index.atomAt(offset)
+	if !ok {
+		return nil, false
+	}
+
+	name := atom.Token.Lexeme
+
+	if sym, ok := doc.index.lookup(name, offset); ok {
+		return sym, true
+	}
+
+	for _, inc := range s.included(doc.index) {
+		var found *symbol
+
+		// the last definition wins
+		for _, sym := range inc.globals() {
+			if sym.name == name {
+				found = sym
+			}
+		}
+
+		if found != nil {
+			return found, true
+		}
+	}
+
+	return nil, false
+}
+
+// included returns the indexes of the files included by an index, directly or not, in breadth-first order.
+func (s *Server) included(ix *index) []*index {
+	var indexes []*index
+
+	seen := map[string]bool{ix.file: true}
+	queue := []*index{ix}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, path := range current.includes {
+			if seen[path] {
+				continue
+			}
+
+			seen[path] = true
+
+			if next, ok := s.indexOf(path); ok {
+				indexes = append(indexes, next)
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return indexes
+}
+
+// indexOf returns the index of a file, open or not.
+func (s *Server) indexOf(path string) (*index, bool) {
+	if doc, ok := s.documents[path]; ok {
+		return doc.index, true
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	ix, err := newIndex(source, path)
+
+	return ix, err == nil
+}
+
+// readFile reads a file from its open document, or from the file system when it is not open.
+func (s *Server) readFile(filename string) ([]byte, error) {
+	if doc, ok := s.documents[filename]; ok {
+		return []byte(doc.text), nil
+	}
+
+	return os.ReadFile(filename)
+}
+
+// text returns the text of a file, empty when it cannot be read.
+func (s *Server) text(path string) string {
+	source, _ := s.readFile(path)
+
+	return string(source)
+}
+
+// decodeParams decodes the params of a request.
+func decodeParams(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// codeBlock formats a Tatu code block in Markdown.
+func codeBlock(code string) string {
+	return "```tatu\n" + code + "\n```"
+}
+
+// paragraph formats a paragraph following a code block in Markdown, empty for an empty text.
+func paragraph(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	return "\n\n" + text
+}
@@ -0,0 +1,148 @@
+package lsp
+
+// signature represents the usage of a native function.
+type signature struct {
+	usage       string
+	description string
+}
+
+// signatures are the usages of the builtins and the standard library, as listed in the cheatsheet.
+var signatures = map[string]signature{
+	// arithmetic, comparison and logical
+	"+":   {"(+ a b ...)", "Addition of numbers or concatenation of strings"},
+	"-":   {"(- a b ...)", "Subtraction, or negation with a single argument"},
+	"*":   {"(* a b ...)", "Multiplication"},
+	"/":   {"(/ a b ...)", "Division"},
+	"%":   {"(% a b)", "Modulo"},
+	"=":   {"(= a b)", "Equality"},
+	"<":   {"(< a b)", "Less than"},
+	"<=":  {"(<= a b)", "Less than or equal"},
+	">":   {"(> a b)", "Greater than"},
+	">=":  {"(>= a b)", "Greater than or equal"},
+	"not": {"(not a)", "Logical negation"},
+
+	// I/O, type checking and conversion
+	"print":       {"(print x ...)", "Print values"},
+	"is-bool":     {"(is-bool x)", "Check if BOOL"},
+	"is-number":   {"(is-number x)", "Check if NUMBER"},
+	"is-int":      {"(is-int x)", "Check if integer NUMBER"},
+	"is-string":   {"(is-string x)", "Check if STRING"},
+	"is-vector":   {"(is-vector x)", "Check if VECTOR"},
+	"is-map":      {"(is-map x)", "Check if MAP"},
+	"is-nil":      {"(is-nil x)", "Check if NIL"},
+	"is-function": {"(is-function x)", "Check if FUNC or NATIVE_FUNC"},
+	"to-string":   {"(to-string x)", "Convert to STRING"},
+	"to-number":   {"(to-number x)", "Convert to NUMBER"},
+	"to-bool":     {"(to-bool x)", "Convert to BOOL"},
+
+	// math
+	"math:pi":      {"(math:pi)", "π constant"},
+	"math:e":       {"(math:e)", "e constant"},
+	"math:abs":     {"(math:abs x)", "Absolute value"},
+	"math:floor":   {"(math:floor x)", "Floor"},
+	"math:ceil":    {"(math:ceil x)", "Ceiling"},
+	"math:round":   {"(math:round x)", "Round"},
+	"math:sqrt":    {"(math:sqrt x)", "Square root"},
+	"math:pow":     {"(math:pow x y)", "Power"},
+	"math:sin":     {"(math:sin x)", "Sine"},
+	"math:cos":     {"(math:cos x)", "Cosine"},
+	"math:tan":     {"(math:tan x)", "Tangent"},
+	"math:log":     {"(math:log x)", "Natural logarithm"},
+	"math:exp":     {"(math:exp x)", "e^x"},
+	"math:min":     {"(math:min x y)", "Minimum"},
+	"math:max":     {"(math:max x y)", "Maximum"},
+	"math:between": {"(math:between x min max)", "Check if x in range [min, max]"},
+	"math:rand":    {"(math:rand min max)", "Random integer in range"},
+
+	// string
+	"str:len":      {"(str:len s)", "Length"},
+	"str:concat":   {"(str:concat s1 s2 ...)", "Concatenate"},
+	"str:split":    {"(str:split s sep)", "Split by separator"},
+	"str:join":     {"(str:join vec sep)", "Join with separator"},
+	"str:slice":    {"(str:slice s start end)", "Substring"},
+	"str:contains": {"(str:contains s substr)", "Check contains"},
+	"str:starts":   {"(str:starts s prefix)", "Check starts with"},
+	"str:ends":     {"(str:ends s suffix)", "Check ends with"},
+	"str:index":    {"(str:index s substr)", "Find index"},
+	"str:upper":    {"(str:upper s)", "Uppercase"},
+	"str:lower":    {"(str:lower s)", "Lowercase"},
+	"str:trim":     {"(str:trim s)", "Trim whitespace"},
+	"str:replace":  {"(str:replace s old new)", "Replace all"},
+	"str:repeat":   {"(str:repeat s n)", "Repeat n times"},
+	"str:reverse":  {"(str:reverse s)", "Reverse"},
+
+	// vector
+	"vec:len":      {"(vec:len v)", "Length"},
+	"vec:get":      {"(vec:get v i)", "Get element at index"},
+	"vec:set":      {"(vec:set v i val)", "Set element at index"},
+	"vec:push":     {"(vec:push v val)", "Append element"},
+	"vec:pop":      {"(vec:pop v)", "Remove last element"},
+	"vec:concat":   {"(vec:concat v1 v2)", "Concatenate"},
+	"vec:slice":    {"(vec:slice v start end)", "Subvector"},
+	"vec:find":     {"(vec:find v val)", "Find index of value"},
+	"vec:contains": {"(vec:contains v val)", "Check contains"},
+	"vec:delete":   {"(vec:delete v i)", "Delete at index"},
+	"vec:reverse":  {"(vec:reverse v)", "Reverse"},
+	"vec:sort":     {"(vec:sort v [less])", "Sort ascending, or with a `(lambda (a b) ...)` returning BOOL"},
+	"vec:map":      {"(vec:map v fn)", "New vector with `fn` applied to each element"},
+	"vec:filter":   {"(vec:filter v pred)", "New vector with the elements `pred` returns `true` for"},
+	"vec:reduce":   {"(vec:reduce v fn init)", "Fold with `(fn acc elem)` starting at `init`"},
+
+	// map
+	"map:len":    {"(map:len m)", "Number of keys"},
+	"map:get":    {"(map:get m key)", "Get value"},
+	"map:get-in": {"(map:get-in m path)", "Deep access with path vector"},
+	"map:set":    {"(map:set m key val)", "Set key-value"},
+	"map:has":    {"(map:has m key)", "Check key exists"},
+	"map:delete": {"(map:delete m key)", "Delete key"},
+	"map:keys":   {"(map:keys m)", "Get all keys"},
+	"map:values": {"(map:values m)", "Get all values"},
+	"map:merge":  {"(map:merge m1 m2)", "Merge maps"},
+	"map:update": {"(map:update m key fn)", "Set key to `(fn current)`, `nil` when missing"},
+
+	// time
+	"time:now":     {"(time:now)", "Current time"},
+	"time:unix":    {"(time:unix t)", "Unix timestamp"},
+	"time:year":    {"(time:year t)", "Get year"},
+	"time:month":   {"(time:month t)", "Get month"},
+	"time:day":     {"(time:day t)", "Get day"},
+	"time:hour":    {"(time:hour t)", "Get hour"},
+	"time:minute":  {"(time:minute t)", "Get minute"},
+	"time:second":  {"(time:second t)", "Get second"},
+	"time:format":  {"(time:format t layout)", "Format time"},
+	"time:parse":   {"(time:parse layout s)", "Parse time"},
+	"time:add":     {"(time:add t duration)", "Add duration"},
+	"time:sub":     {"(time:sub t duration)", "Subtract duration"},
+	"time:diff":    {"(time:diff t1 t2)", "Difference"},
+	"time:is-leap": {"(time:is-leap year)", "Check leap year"},
+
+	// JSON
+	"json:encode": {"(json:encode val)", "Encode to JSON"},
+	"json:decode": {"(json:decode s)", "Decode from JSON"},
+
+	// file system
+	"fs:read":       {"(fs:read path)", "Read file"},
+	"fs:write":      {"(fs:write path content)", "Write file"},
+	"fs:append":     {"(fs:append path content)", "Append to file"},
+	"fs:delete":     {"(fs:delete path)", "Delete file"},
+	"fs:exists":     {"(fs:exists path)", "Check exists"},
+	"fs:list":       {"(fs:list path)", "List directory"},
+	"fs:mkdir":      {"(fs:mkdir path)", "Create directory"},
+	"fs:move":       {"(fs:move src dst)", "Move/rename"},
+	"fs:is-dir":     {"(fs:is-dir path)", "Check if directory"},
+	"fs:basename":   {"(fs:basename path)", "Get basename"},
+	"fs:size":       {"(fs:size path)", "Get file size"},
+	"fs:temp-dir":   {"(fs:temp-dir)", "Get temp directory"},
+	"fs:read-lines": {"(fs:read-lines path)", "Read lines"},
+
+	// regex
+	"regex:matches": {"(regex:matches s pattern)", "Check if matches"},
+	"regex:find":    {"(regex:find s pattern)", "Find first match (nil if no match)"},
+	"regex:replace": {"(regex:replace s pattern repl)", "Replace all"},
+}
+
+// specialForms are the symbols of the special forms and literals, completed next to the natives and bindings.
+var specialForms = []string{
+	"and", "or", "block", "var", "set", "if", "while", "lambda", "recur", "vector", "map",
+	"include", "def", "for", "switch", "macro", "true", "false", "nil",
+}
@@ -349,5 +349,5 @@ func spliceCapture(name string, caps bindings, out []ast.SExpr) ([]ast.SExpr, bo
 
 // error builds a macro expansion error with location.
 func (e *Expander) error(msg string, loc location.Location) *debug.Error {
-	return &debug.Error{Msg: msg, Line: loc.End.Line, Column: loc.End.Column, File: loc.File}
+	return &debug.Error{Msg: msg, Line: loc.End.Line, Column: loc.End.Column, File: loc.File, Location: loc}
 }
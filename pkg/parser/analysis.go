@@ -286,9 +286,10 @@ func (sa *SyntaxAnalyzer) validateUnresolved(expr *ast.ListExpr) error {
 // error makes an error.
 func (sa *SyntaxAnalyzer) error(msg string, loc location.Location) *debug.Error {
 	return &debug.Error{
-		Msg:    msg,
-		Line:   loc.End.Line,
-		Column: loc.End.Column,
-		File:   loc.File,
+		Msg:      msg,
+		Line:     loc.End.Line,
+		Column:   loc.End.Column,
+		File:     loc.File,
+		Location: loc,
 	}
 }
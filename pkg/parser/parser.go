@@ -15,13 +15,31 @@ type Parser struct {
 	current int
 	tokens  []token.Token
 	sugar   SyntaxSugar
+	literal bool
+}
+
+// Option configures a Parser.
+type Option func(p *Parser)
+
+// WithoutSugar keeps the `def`, `switch` and `for` forms as written instead of transforming them,
+// e.g. for a formatter.
+func WithoutSugar() Option {
+	return func(p *Parser) {
+		p.literal = true
+	}
 }
 
 // NewParser builds a new Parser.
-func NewParser() *Parser {
-	return &Parser{
+func NewParser(opts ...Option) *Parser {
+	p := &Parser{
 		sugar: SyntaxSugar{},
 	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
 }
 
 // Parse parses the tokens and generates a resulting AST.
@@ -151,6 +169,10 @@ func (p *Parser) parseList() (ast.SExpr, error) {
 		location.NewPosition(endLoc.End.Line, endLoc.End.Column, endLoc.End.Offset),
 	))
 
+	if p.literal {
+		return listExpr, nil
+	}
+
 	if err := p.sugar.Transform(&listExpr); err != nil {
 		return nil, err
 	}
@@ -194,9 +216,10 @@ func (p *Parser) parseProgram() ([]ast.SExpr, error) {
 // error makes an error.
 func (p *Parser) error(msg string, loc location.Location) *debug.Error {
 	return &debug.Error{
-		Msg:    msg,
-		Line:   loc.End.Line,
-		Column: loc.End.Column,
-		File:   loc.File,
+		Msg:      msg,
+		Line:     loc.End.Line,
+		Column:   loc.End.Column,
+		File:     loc.File,
+		Location: loc,
 	}
 }
@@ -174,9 +174,10 @@ func (ss *SyntaxSugar) switchToIf(expr *ast.SExpr) error {
 // error makes an error.
 func (ss *SyntaxSugar) error(msg string, loc location.Location) *debug.Error {
 	return &debug.Error{
-		Msg:    msg,
-		Line:   loc.End.Line,
-		Column: loc.End.Column,
-		File:   loc.File,
+		Msg:      msg,
+		Line:     loc.End.Line,
+		Column:   loc.End.Column,
+		File:     loc.File,
+		Location: loc,
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/danielspk/tatu-lang/pkg/ast"
 	"github.com/danielspk/tatu-lang/pkg/debug"
 	"github.com/danielspk/tatu-lang/pkg/token"
+	"github.com/danielspk/tatu-lang/pkg/vm"
 )
 
 // FormatRunningExecution formats running execution.
@@ -30,6 +31,14 @@ func FormatError(err error, sources map[string][]byte) string {
 		return fmt.Sprintf("%s>>> %s%s\n", ColorRed, prettyError(tatuErr, sources[tatuErr.File]), ColorReset)
 	}
 
+	var limitErr *debug.LimitError
+
+	if errors.As(err, &limitErr) {
+		tatuErr = &debug.Error{Msg: limitErr.Msg, Line: limitErr.Line, Column: limitErr.Column, File: limitErr.File}
+
+		return fmt.Sprintf("%s>>> %s%s\n", ColorRed, prettyError(tatuErr, sources[tatuErr.File]), ColorReset)
+	}
+
 	return fmt.Sprintf("%s>>> Error: %s%s\n", ColorRed, err, ColorReset)
 }
 
@@ -84,6 +93,15 @@ func FormatAST(ast *ast.AST) string {
 	return sb.String()
 }
 
+// FormatBytecode formats the disassembled bytecode of a compiled code and its nested functions.
+func FormatBytecode(code *vm.Code) string {
+	var sb strings.Builder
+
+	prettyBytecode(&sb, code)
+
+	return sb.String()
+}
+
 // prettyError dumps the error message next to reference source code.
 func prettyError(e *debug.Error, source []byte) string {
 	lines := strings.Split(string(source), "\n")
@@ -145,3 +163,37 @@ func prettyExpression(sb *strings.Builder, expr ast.SExpr, depth int) {
 		ColorDarkGray, expr.Location().Start.Line, expr.Location().Start.Column,
 		expr.Location().End.Line, expr.Location().End.Column, expr.Location().File, ColorReset))
 }
+
+func prettyBytecode(sb *strings.Builder, code *vm.Code) {
+	upvalues := make([]string, 0, len(code.Upvalues))
+
+	for _, upvalue := range code.Upvalues {
+		upvalues = append(upvalues, upvalue.Name)
+	}
+
+	sb.WriteString(fmt.Sprintf("%s== %s (%s) [%s] ==%s\n", ColorPurple, code.Name, strings.Join(code.Params, " "),
+		strings.Join(upvalues, " "), ColorReset))
+
+	instructions, err := vm.Disassemble(code)
+	if err != nil {
+		sb.WriteString(fmt.Sprintf("%s%s%s\n", ColorRed, err, ColorReset))
+	}
+
+	for _, ins := range instructions {
+		operands := make([]string, 0, len(ins.Operands))
+
+		for _, operand := range ins.Operands {
+			operands = append(operands, fmt.Sprintf("%d", operand))
+		}
+
+		sb.WriteString(fmt.Sprintf("%s%04d %s%-16s %s%-6s %s%-24s%s => start(%d:%d) end(%d:%d) file(%s)%s\n",
+			ColorDarkGray, ins.Offset, ColorCyan, ins.Opcode, ColorGreen, strings.Join(operands, " "),
+			ColorOrange, ins.Describe(code), ColorDarkGray, ins.Location.Start.Line, ins.Location.Start.Column,
+			ins.Location.End.Line, ins.Location.End.Column, ins.Location.File, ColorReset))
+	}
+
+	for _, fn := range code.Functions {
+		sb.WriteString("\n")
+		prettyBytecode(sb, fn)
+	}
+}
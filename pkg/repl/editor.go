@@ -0,0 +1,397 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when the line is abandoned with Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+// LineReader reads the input lines of a REPL.
+type LineReader interface {
+	// ReadLine shows a prompt and reads a line without its newline, returning io.EOF at the end of the input.
+	ReadLine(prompt string) (string, error)
+}
+
+// Completer returns the completions of a word, e.g. `str:upper` and `str:trim` for `str:`.
+type Completer func(word string) []string
+
+// control keys
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// plainReader reads lines without editing, e.g. from a pipe.
+type plainReader struct {
+	lines *bufio.Scanner
+	out   io.Writer
+}
+
+// ReadLine shows a prompt and reads a line.
+func (p *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(p.out, prompt)
+
+	if !p.lines.Scan() {
+		if err := p.lines.Err(); err != nil {
+			return "", err
+		}
+
+		return "", io.EOF
+	}
+
+	return p.lines.Text(), nil
+}
+
+// Editor reads lines from a terminal with line editing, history and completion:
+//   - Left, Right, Home, End, Ctrl-B, Ctrl-F, Ctrl-A and Ctrl-E move the cursor,
+//   - Backspace, Delete, Ctrl-K, Ctrl-U and Ctrl-W delete text,
+//   - Up, Down, Ctrl-P and Ctrl-N browse the history and Tab completes the word before the cursor,
+//   - Ctrl-C abandons the line, Ctrl-D on an empty line ends the input and Ctrl-L clears the screen.
+type Editor struct {
+	in        *bufio.Reader
+	out       io.Writer
+	history   *History
+	completer Completer
+	fd        uintptr
+	raw       bool
+
+	prompt string
+	line   []rune
+	pos    int    // cursor position in line
+	index  int    // history entry shown, the number of entries for the new line
+	draft  []rune // new line kept while browsing the history
+}
+
+// EditorOption configures an Editor.
+type EditorOption func(e *Editor)
+
+// WithHistory records the lines read in a history and browses it with Up and Down.
+func WithHistory(history *History) EditorOption {
+	return func(e *Editor) {
+		e.history = history
+	}
+}
+
+// WithCompleter completes the word before the cursor with Tab.
+func WithCompleter(completer Completer) EditorOption {
+	return func(e *Editor) {
+		e.completer = completer
+	}
+}
+
+// WithRawMode puts a terminal in raw mode while reading each line, e.g. `WithRawMode(os.Stdin.Fd())`.
+// Between lines the terminal is restored, so the evaluations can be interrupted and read input as usual.
+func WithRawMode(fd uintptr) EditorOption {
+	return func(e *Editor) {
+		e.fd, e.raw = fd, true
+	}
+}
+
+// NewEditor builds a new Editor reading keys from in and drawing the line on out.
+func NewEditor(in io.Reader, out io.Writer, opts ...EditorOption) *Editor {
+	e := &Editor{in: bufio.NewReader(in), out: out}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	if e.history == nil {
+		e.history, _ = LoadHistory("")
+	}
+
+	return e
+}
+
+// ReadLine shows a prompt and reads a line, recording it in the history.
+// Errors writing the history file are ignored, so they do not end the session.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.raw {
+		restore, err := MakeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.prompt, e.line, e.pos, e.draft = prompt, nil, 0, nil
+	e.index = len(e.history.Entries())
+	e.refresh()
+
+	for {
+		key, _, err := e.in.ReadRune()
+		if errors.Is(err, io.EOF) && len(e.line) > 0 {
+			return e.accept(), nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case '\r', '\n':
+			return e.accept(), nil
+
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\n")
+			return "", ErrInterrupted
+
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				return "", io.EOF
+			}
+
+			e.delete(e.pos, e.pos+1)
+
+		case keyCtrlA:
+			e.move(0)
+		case keyCtrlE:
+			e.move(len(e.line))
+		case keyCtrlB:
+			e.move(e.pos - 1)
+		case keyCtrlF:
+			e.move(e.pos + 1)
+		case keyBackspace, keyCtrlH:
+			e.delete(e.pos-1, e.pos)
+		case keyCtrlK:
+			e.delete(e.pos, len(e.line))
+		case keyCtrlU:
+			e.delete(0, e.pos)
+		case keyCtrlW:
+			e.delete(e.previousWord(), e.pos)
+		case keyCtrlP:
+			e.browse(-1)
+		case keyCtrlN:
+			e.browse(1)
+		case keyTab:
+			e.complete()
+
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+			e.refresh()
+
+		case keyEscape:
+			if err := e.escape(); err != nil {
+				return "", err
+			}
+
+		default:
+			if unicode.IsPrint(key) {
+				e.insert([]rune{key})
+			}
+		}
+	}
+}
+
+// escape handles the escape sequences of the arrow, Home, End and Delete keys, ignoring their modifiers.
+func (e *Editor) escape() error {
+	kind, _, err := e.in.ReadRune()
+	if err != nil || kind != '[' && kind != 'O' {
+		return err
+	}
+
+	// parameters like the `3` of `ESC [ 3 ~` or the `1;5` of `ESC [ 1 ; 5 C` come before the final key
+	var params strings.Builder
+
+	key, _, err := e.in.ReadRune()
+
+	for err == nil && (key >= '0' && key <= '9' || key == ';') {
+		params.WriteRune(key)
+		key, _, err = e.in.ReadRune()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if key == '~' {
+		code, _, _ := strings.Cut(params.String(), ";")
+
+		switch code {
+		case "1", "7":
+			key = 'H'
+		case "4", "8":
+			key = 'F'
+		case "3":
+			e.delete(e.pos, e.pos+1)
+		}
+	}
+
+	switch key {
+	case 'A':
+		e.browse(-1)
+	case 'B':
+		e.browse(1)
+	case 'C':
+		e.move(e.pos + 1)
+	case 'D':
+		e.move(e.pos - 1)
+	case 'H':
+		e.move(0)
+	case 'F':
+		e.move(len(e.line))
+	}
+
+	return nil
+}
+
+// accept ends the line, recording it in the history.
+func (e *Editor) accept() string {
+	fmt.Fprint(e.out, "\n")
+
+	line := string(e.line)
+	_ = e.history.Add(line)
+
+	return line
+}
+
+// insert inserts text at the cursor.
+func (e *Editor) insert(text []rune) {
+	e.line = append(e.line[:e.pos], append(text, e.line[e.pos:]...)...)
+	e.pos += len(text)
+	e.refresh()
+}
+
+// delete deletes the text between two positions, clamped to the line.
+func (e *Editor) delete(from, to int) {
+	from, to = max(from, 0), min(to, len(e.line))
+
+	if from >= to {
+		return
+	}
+
+	e.line = append(e.line[:from], e.line[to:]...)
+
+	if e.pos > to {
+		e.pos -= to - from
+	} else if e.pos > from {
+		e.pos = from
+	}
+
+	e.refresh()
+}
+
+// move moves the cursor, clamped to the line.
+func (e *Editor) move(pos int) {
+	e.pos = min(max(pos, 0), len(e.line))
+	e.refresh()
+}
+
+// browse shows the previous (-1) or next (1) history entry, keeping the new line to come back to it.
+func (e *Editor) browse(step int) {
+	entries := e.history.Entries()
+	index := e.index + step
+
+	if index < 0 || index > len(entries) {
+		return
+	}
+
+	if e.index == len(entries) {
+		e.draft = append([]rune(nil), e.line...)
+	}
+
+	e.index = index
+
+	if index == len(entries) {
+		e.line = e.draft
+	} else {
+		e.line = []rune(entries[index])
+	}
+
+	e.move(len(e.line))
+}
+
+// complete completes the word before the cursor: a single completion is inserted, several ones are
+// extended to their common prefix or listed below the line.
+func (e *Editor) complete() {
+	start := e.symbolStart()
+	word := string(e.line[start:e.pos])
+
+	if e.completer == nil || word == "" {
+		return
+	}
+
+	completions := e.completer(word)
+
+	if len(completions) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return
+	}
+
+	prefix := completions[0]
+
+	for _, completion := range completions[1:] {
+		for !strings.HasPrefix(completion, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	if len(prefix) > len(word) {
+		e.insert([]rune(prefix[len(word):]))
+		return
+	}
+
+	if len(completions) > 1 {
+		fmt.Fprintf(e.out, "\n%s\n", strings.Join(completions, "  "))
+		e.refresh()
+	}
+}
+
+// symbolStart returns the start of the symbol before the cursor.
+func (e *Editor) symbolStart() int {
+	start := e.pos
+
+	for start > 0 && !isDelimiter(e.line[start-1]) {
+		start--
+	}
+
+	return start
+}
+
+// previousWord returns the start of the word before the cursor, including the spaces that follow it.
+func (e *Editor) previousWord() int {
+	start := e.pos
+
+	for start > 0 && unicode.IsSpace(e.line[start-1]) {
+		start--
+	}
+
+	for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+		start--
+	}
+
+	return start
+}
+
+// refresh redraws the line and places the cursor.
+func (e *Editor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.line))
+
+	if back := len(e.line) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+// isDelimiter checks if a rune ends a symbol.
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' || r == ';'
+}
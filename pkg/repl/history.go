@@ -0,0 +1,102 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// defaultHistorySize is the number of lines kept by a History.
+const defaultHistorySize = 1000
+
+// History holds the input lines of the previous sessions, persisted in a file, e.g. `~/.tatu_history`.
+type History struct {
+	path    string
+	size    int
+	entries []string
+}
+
+// LoadHistory builds a History backed by a file, reading its lines. A missing file starts an empty history.
+// An empty path keeps the history in memory only.
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path, size: defaultHistorySize}
+
+	if path == "" {
+		return h, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := bufio.NewScanner(file)
+
+	for lines.Scan() {
+		h.push(lines.Text())
+	}
+
+	return h, lines.Err()
+}
+
+// Entries returns the lines of the history, oldest first.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add records a line, skipping blank lines and repetitions of the last one, and appends it to the file.
+// When the history is full, the file is rewritten with its newest lines.
+func (h *History) Add(line string) error {
+	if strings.TrimSpace(line) == "" || len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return nil
+	}
+
+	if !h.push(line) {
+		return h.save()
+	}
+
+	if h.path == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(line + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// push adds a line in memory, dropping the oldest ones beyond the size. It reports whether none was dropped.
+func (h *History) push(line string) bool {
+	h.entries = append(h.entries, line)
+
+	if len(h.entries) <= h.size {
+		return true
+	}
+
+	h.entries = h.entries[len(h.entries)-h.size:]
+
+	return false
+}
+
+// save rewrites the file with the lines in memory.
+func (h *History) save() error {
+	if h.path == "" {
+		return nil
+	}
+
+	return os.WriteFile(h.path, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600)
+}
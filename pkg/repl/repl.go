@@ -0,0 +1,342 @@
+// Package repl implements the interactive read-eval-print loop.
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/danielspk/tatu-lang/pkg/ast"
+	"github.com/danielspk/tatu-lang/pkg/builder"
+	"github.com/danielspk/tatu-lang/pkg/debug"
+	"github.com/danielspk/tatu-lang/pkg/interpreter"
+	"github.com/danielspk/tatu-lang/pkg/macro"
+	"github.com/danielspk/tatu-lang/pkg/parser"
+	"github.com/danielspk/tatu-lang/pkg/pretty"
+	"github.com/danielspk/tatu-lang/pkg/scanner"
+	"github.com/danielspk/tatu-lang/pkg/token"
+)
+
+const (
+	prompt             = "tatu> "
+	continuationPrompt = "....> "
+)
+
+// specialForms are the symbols of the special forms and literals, completed next to the natives and globals.
+var specialForms = []string{
+	"and", "or", "not", "block", "var", "set", "if", "while", "lambda", "recur", "vector", "map",
+	"include", "def", "for", "switch", "macro", "true", "false", "nil",
+}
+
+// inspectedSource is the name of the sources of the `:ast` and `:tokens` commands.
+const inspectedSource = "<inspect>"
+
+// unterminatedString is the scanner error of a string still open at the end of the input.
+const unterminatedString = "unterminated string"
+
+const help = `Enter expressions to evaluate them. Forms spanning several lines are read until their parens are balanced.
+
+Commands:
+  :ast <source>     print the AST of a source without evaluating it
+  :tokens <source>  print the tokens of a source
+  :env              print the user-defined global variables
+  :help             print this help
+  :quit             exit the REPL (also :exit or end of input)
+`
+
+// REPL represents an interactive session keeping the global scope and the macros between inputs.
+type REPL struct {
+	out      io.Writer
+	inter    *interpreter.Interpreter
+	scanner  *scanner.Scanner
+	parser   *parser.Parser
+	expander *macro.Expander
+	analyzer *parser.SyntaxAnalyzer
+	includes *builder.ProgramBuilder
+	sources  map[string][]byte
+	inputs   int
+}
+
+// Option configures a REPL.
+type Option func(r *REPL)
+
+// WithInterpreter evaluates the inputs with the given interpreter instead of a new one,
+// e.g. one with execution limits or registered Go functions.
+func WithInterpreter(inter *interpreter.Interpreter) Option {
+	return func(r *REPL) {
+		r.inter = inter
+	}
+}
+
+// NewREPL builds a new REPL writing its prompts and results to out.
+func NewREPL(out io.Writer, opts ...Option) *REPL {
+	r := &REPL{
+		out:      out,
+		scanner:  scanner.NewScanner(),
+		parser:   parser.NewParser(),
+		expander: macro.NewExpander(),
+		analyzer: parser.NewSyntaxAnalyzer(),
+		sources:  make(map[string][]byte),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.inter == nil {
+		r.inter = interpreter.NewInterpreter()
+	}
+
+	// included files share the macros of the session
+	r.includes = builder.NewProgramBuilder(scanner.NewScanner(), parser.NewParser(), r.expander, parser.NewSyntaxAnalyzer())
+
+	return r
+}
+
+// Run reads inputs until the end of in or a `:quit` command, printing the result of each one.
+// Errors are printed without ending the session.
+func (r *REPL) Run(in io.Reader) error {
+	return r.RunWith(&plainReader{lines: bufio.NewScanner(in), out: r.out})
+}
+
+// RunWith runs the session reading the lines from a LineReader, e.g. an Editor.
+// An interrupted line discards the pending input.
+func (r *REPL) RunWith(lines LineReader) error {
+	var input strings.Builder
+
+	for {
+		linePrompt := prompt
+		if input.Len() > 0 {
+			linePrompt = continuationPrompt
+		}
+
+		line, err := lines.ReadLine(linePrompt)
+		if errors.Is(err, ErrInterrupted) {
+			input.Reset()
+			continue
+		}
+
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(r.out)
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if input.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := r.Command(strings.TrimSpace(line)); quit {
+				return nil
+			}
+
+			continue
+		}
+
+		input.WriteString(line)
+		input.WriteString("\n")
+
+		if r.pending(input.String()) {
+			continue
+		}
+
+		r.Eval(input.String())
+		input.Reset()
+	}
+}
+
+// Complete returns the sorted symbols starting with a prefix: the special forms, the natives and the user globals.
+func (r *REPL) Complete(prefix string) []string {
+	names := slices.Concat(specialForms, slices.Collect(maps.Keys(r.inter.Natives())), slices.Collect(maps.Keys(r.inter.Globals())))
+
+	var completions []string
+
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			completions = append(completions, name)
+		}
+	}
+
+	slices.Sort(completions)
+
+	return slices.Compact(completions)
+}
+
+// Eval evaluates a complete input, printing the result of each top-level expression or the first error.
+func (r *REPL) Eval(source string) {
+	if strings.TrimSpace(source) == "" {
+		return
+	}
+
+	_, program, err := r.build(source)
+	if err != nil {
+		r.printError(err)
+		return
+	}
+
+	for _, expr := range program.Program {
+		result, err := r.inter.Eval(expr, nil)
+		if err != nil {
+			r.printError(err)
+			return
+		}
+
+		fmt.Fprintln(r.out, result)
+	}
+}
+
+// Command runs a REPL command, e.g. `:env`, and reports whether the session ends.
+func (r *REPL) Command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":quit", ":exit":
+		return true
+
+	case ":help":
+		fmt.Fprint(r.out, help)
+
+	case ":env":
+		globals := r.inter.Globals()
+
+		for _, name := range slices.Sorted(maps.Keys(globals)) {
+			fmt.Fprintf(r.out, "%s = %s\n", name, globals[name])
+		}
+
+	case ":ast", ":tokens":
+		if arg == "" {
+			fmt.Fprintf(r.out, "usage: %s <source>\n", name)
+			break
+		}
+
+		// inspecting a source does not change the session: a throwaway builder keeps its macros and includes
+		inspector := builder.NewProgramBuilderWithDefaults()
+
+		tokens, program, err := inspector.BuildFromSource([]byte(arg), inspectedSource)
+		if err != nil {
+			fmt.Fprint(r.out, pretty.FormatError(err, inspector.Sources()))
+			break
+		}
+
+		if name == ":tokens" {
+			for _, tok := range tokens {
+				fmt.Fprintln(r.out, pretty.FormatToken(tok))
+			}
+
+			break
+		}
+
+		fmt.Fprint(r.out, pretty.FormatAST(program))
+
+	default:
+		fmt.Fprintf(r.out, "unknown command `%s`, type :help for the list of commands\n", name)
+	}
+
+	return false
+}
+
+// pending checks if an input needs more lines: it has unbalanced open parens or an unterminated string.
+// Inputs with extra closing parens are complete, so the parser reports them.
+func (r *REPL) pending(source string) bool {
+	tokens, err := r.scanner.Scan([]byte(source), "")
+	if err != nil {
+		var tatuErr *debug.Error
+
+		return errors.As(err, &tatuErr) && tatuErr.Msg == unterminatedString
+	}
+
+	depth := 0
+
+	for _, tok := range tokens {
+		switch tok.Type {
+		case token.LeftParen:
+			depth++
+		case token.RightParen:
+			depth--
+		}
+	}
+
+	return depth > 0
+}
+
+// build scans, parses, resolves the includes, expands the macros and analyzes an input.
+// Each input is a source of its own, so errors of functions defined by earlier inputs show the right lines.
+func (r *REPL) build(source string) ([]token.Token, *ast.AST, error) {
+	r.inputs++
+	filename := fmt.Sprintf("<input %d>", r.inputs)
+	r.sources[filename] = []byte(source)
+
+	tokens, err := r.scanner.Scan([]byte(source), filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	program, err := r.parser.Parse(tokens)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exprs := make([]ast.SExpr, 0, len(program.Program))
+
+	for _, expr := range program.Program {
+		includeFile, ok := includePath(expr)
+		if !ok {
+			exprs = append(exprs, expr)
+			continue
+		}
+
+		incTokens, included, err := r.includes.BuildFromFile(includeFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tokens = append(tokens, incTokens...)
+		exprs = append(exprs, included.Program...)
+	}
+
+	program.Program = exprs
+
+	program, err = r.expander.Expand(program)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := r.analyzer.Analyze(program); err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, program, nil
+}
+
+// printError prints an error next to the source it refers to, from an input or an included file.
+func (r *REPL) printError(err error) {
+	sources := maps.Clone(r.sources)
+	maps.Copy(sources, r.includes.Sources())
+
+	fmt.Fprint(r.out, pretty.FormatError(err, sources))
+}
+
+// includePath returns the file of an `(include "file")` expression, resolved from the working directory.
+func includePath(expr ast.SExpr) (string, bool) {
+	list, ok := expr.(*ast.ListExpr)
+	if !ok || len(list.List) != 2 {
+		return "", false
+	}
+
+	head, ok := list.List[0].(*ast.SymbolExpr)
+	if !ok || head.Symbol != "include" {
+		return "", false
+	}
+
+	file, ok := list.List[1].(*ast.StringExpr)
+	if !ok {
+		return "", false
+	}
+
+	return file.String, true
+}
@@ -0,0 +1,29 @@
+package repl
+
+import "errors"
+
+// ErrNotTerminal is returned when raw mode is requested on a file that is not a terminal.
+var ErrNotTerminal = errors.New("not a terminal")
+
+// IsTerminal checks if a file descriptor is a terminal, e.g. `IsTerminal(os.Stdin.Fd())`.
+func IsTerminal(fd uintptr) bool {
+	_, err := getState(fd)
+
+	return err == nil
+}
+
+// MakeRaw puts a terminal in raw mode, reading each key without echo, and returns a function restoring its state.
+func MakeRaw(fd uintptr) (func() error, error) {
+	state, err := getState(fd)
+	if err != nil {
+		return nil, ErrNotTerminal
+	}
+
+	if err := setState(fd, rawState(state)); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return setState(fd, state)
+	}, nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package repl
+
+// termState is the settings of a terminal, unsupported on this platform.
+type termState struct{}
+
+// getState reports every file as not being a terminal.
+func getState(_ uintptr) (*termState, error) {
+	return nil, ErrNotTerminal
+}
+
+// setState is never called, as there are no terminals.
+func setState(_ uintptr, _ *termState) error {
+	return ErrNotTerminal
+}
+
+// rawState keeps the settings.
+func rawState(state *termState) *termState {
+	return state
+}
@@ -0,0 +1,43 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// getState reads the settings of a terminal.
+func getState(fd uintptr) (*syscall.Termios, error) {
+	state := &syscall.Termios{}
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(state))); errno != 0 {
+		return nil, errno
+	}
+
+	return state, nil
+}
+
+// setState writes the settings of a terminal.
+func setState(fd uintptr, state *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(state))); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// rawState returns the settings of a terminal without line buffering, echo and signal keys, reading a byte at a time.
+// Output processing is kept, so newlines still return the carriage.
+func rawState(state *syscall.Termios) *syscall.Termios {
+	raw := *state
+
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	return &raw
+}
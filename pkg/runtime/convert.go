@@ -0,0 +1,476 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxConversionDepth bounds the nesting of converted Go values, so cyclic pointers fail instead of overflowing the stack.
+const maxConversionDepth = 1000
+
+var valueType = reflect.TypeFor[Value]()
+
+// ConversionError reports a value that cannot be converted between Tatu and Go.
+type ConversionError struct {
+	Expected string // expected Tatu type, e.g. NUMBER or `integer NUMBER in range of int8`
+	Found    string // found Tatu type or value
+	Path     string // position of the value inside the converted one, e.g. `[2].name`
+}
+
+// Error shows the error message.
+func (e *ConversionError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("expected %s, got %s", e.Expected, e.Found)
+	}
+
+	return fmt.Sprintf("expected %s at %s, got %s", e.Expected, e.Path, e.Found)
+}
+
+// FromGo converts a Go value to a Tatu value:
+//   - numbers to NUMBER, strings to STRING and bools to BOOL,
+//   - slices and arrays to VECTOR,
+//   - maps with string keys and structs to MAP,
+//   - nil pointers, interfaces, slices and maps to NIL,
+//   - values that already are a Value are kept.
+//
+// Struct fields are keyed by their `tatu:"name"` tag, or by their name starting in lower case.
+// Fields tagged `tatu:"-"` and unexported fields are skipped, and `tatu:",omitempty"` skips zero values.
+func FromGo(value any) (Value, error) {
+	return fromGo(reflect.ValueOf(value), 0)
+}
+
+// ToGo converts a Tatu value into the Go value target points to, following the rules of FromGo in reverse.
+// NIL converts to nil pointers, slices and maps. Targets of type `any` receive float64, string, bool, nil, []any or map[string]any values.
+// Map keys without a matching struct field are ignored.
+func ToGo(value Value, target any) error {
+	ptr := reflect.ValueOf(target)
+
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("cannot convert to %T: expected a non-nil pointer", target)
+	}
+
+	if err := CheckGoType(ptr.Type().Elem()); err != nil {
+		return err
+	}
+
+	converted, err := toGo(value, ptr.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	ptr.Elem().Set(converted)
+
+	return nil
+}
+
+// CheckGoType checks that values of a Go type can be converted from and to Tatu values.
+func CheckGoType(t reflect.Type) error {
+	return checkGoType(t, make(map[reflect.Type]bool))
+}
+
+// checkGoType checks a Go type, keeping the structs being checked in seen so recursive types are accepted.
+func checkGoType(t reflect.Type, seen map[reflect.Type]bool) error {
+	if t == valueType || t.Kind() == reflect.Interface && t.NumMethod() == 0 || seen[t] {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return nil
+
+	case reflect.Slice, reflect.Array, reflect.Pointer:
+		return checkGoType(t.Elem(), seen)
+
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+
+		return checkGoType(t.Elem(), seen)
+
+	case reflect.Struct:
+		seen[t] = true
+
+		for idx := range t.NumField() {
+			field := t.Field(idx)
+
+			if _, _, ok := fieldKey(field); !ok {
+				continue
+			}
+
+			if err := checkGoType(field.Type, seen); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// fromGo converts a Go value to a Tatu value.
+func fromGo(value reflect.Value, depth int) (Value, error) {
+	if !value.IsValid() {
+		return NewNil(), nil
+	}
+
+	if depth > maxConversionDepth {
+		return nil, fmt.Errorf("cannot convert %s: exceeded %d nested values", value.Type(), maxConversionDepth)
+	}
+
+	if value.Type().Implements(valueType) {
+		if value.Kind() == reflect.Interface && value.IsNil() {
+			return NewNil(), nil
+		}
+
+		return value.Interface().(Value), nil
+	}
+
+	switch value.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if value.IsNil() {
+			return NewNil(), nil
+		}
+
+		return fromGo(value.Elem(), depth+1)
+
+	case reflect.Bool:
+		return NewBool(value.Bool()), nil
+
+	case reflect.String:
+		return NewString(value.String()), nil
+
+	case reflect.Float32, reflect.Float64:
+		return NewNumber(value.Float()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewNumber(float64(value.Int())), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return NewNumber(float64(value.Uint())), nil
+
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return NewNil(), nil
+		}
+
+		elements := make([]Value, value.Len())
+
+		for idx := range elements {
+			elem, err := fromGo(value.Index(idx), depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			elements[idx] = elem
+		}
+
+		return NewVector(elements), nil
+
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", value.Type().Key())
+		}
+
+		if value.IsNil() {
+			return NewNil(), nil
+		}
+
+		elements := make(map[string]Value, value.Len())
+
+		for iter := value.MapRange(); iter.Next(); {
+			elem, err := fromGo(iter.Value(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			elements[iter.Key().String()] = elem
+		}
+
+		return NewMap(elements), nil
+
+	case reflect.Struct:
+		elements := make(map[string]Value, value.NumField())
+
+		for idx := range value.NumField() {
+			key, omitEmpty, ok := fieldKey(value.Type().Field(idx))
+			if !ok || omitEmpty && value.Field(idx).IsZero() {
+				continue
+			}
+
+			elem, err := fromGo(value.Field(idx), depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			elements[key] = elem
+		}
+
+		return NewMap(elements), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported type %s", value.Type())
+	}
+}
+
+// toGo converts a Tatu value to a Go value of the given type.
+func toGo(value Value, t reflect.Type) (reflect.Value, error) {
+	if t == valueType {
+		return reflect.ValueOf(&value).Elem(), nil
+	}
+
+	if value.Type() == NilType && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map) {
+		return reflect.Zero(t), nil
+	}
+
+	mismatch := func(expected string) (reflect.Value, error) {
+		return reflect.Value{}, &ConversionError{Expected: expected, Found: value.Type().String()}
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		native, err := toNative(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		result := reflect.New(t).Elem()
+
+		if native != nil {
+			result.Set(reflect.ValueOf(native))
+		}
+
+		return result, nil
+
+	case reflect.Pointer:
+		elem, err := toGo(value, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+
+		return ptr, nil
+
+	case reflect.Bool:
+		b, ok := value.(Bool)
+		if !ok {
+			return mismatch("BOOL")
+		}
+
+		return reflect.ValueOf(b.Value).Convert(t), nil
+
+	case reflect.String:
+		s, ok := value.(String)
+		if !ok {
+			return mismatch("STRING")
+		}
+
+		return reflect.ValueOf(s.Value).Convert(t), nil
+
+	case reflect.Float32, reflect.Float64:
+		n, ok := value.(Number)
+		if !ok {
+			return mismatch("NUMBER")
+		}
+
+		return reflect.ValueOf(n.Value).Convert(t), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := value.(Number)
+		if !ok {
+			return mismatch("integer NUMBER")
+		}
+
+		result := reflect.New(t).Elem()
+
+		if n.Value != math.Trunc(n.Value) || !fitsInteger(result, n.Value) {
+			return reflect.Value{}, &ConversionError{Expected: fmt.Sprintf("integer NUMBER in range of %s", t), Found: n.String()}
+		}
+
+		if result.CanInt() {
+			result.SetInt(int64(n.Value))
+		} else {
+			result.SetUint(uint64(n.Value))
+		}
+
+		return result, nil
+
+	case reflect.Slice, reflect.Array:
+		vec, ok := value.(*Vector)
+		if !ok {
+			return mismatch("VECTOR")
+		}
+
+		var result reflect.Value
+
+		if t.Kind() == reflect.Array {
+			if len(vec.Elements) != t.Len() {
+				return reflect.Value{}, &ConversionError{Expected: fmt.Sprintf("VECTOR of %d elements", t.Len()), Found: fmt.Sprintf("%d elements", len(vec.Elements))}
+			}
+
+			result = reflect.New(t).Elem()
+		} else {
+			result = reflect.MakeSlice(t, len(vec.Elements), len(vec.Elements))
+		}
+
+		for idx, elem := range vec.Elements {
+			converted, err := toGo(elem, t.Elem())
+			if err != nil {
+				return reflect.Value{}, nested(err, fmt.Sprintf("[%d]", idx))
+			}
+
+			result.Index(idx).Set(converted)
+		}
+
+		return result, nil
+
+	case reflect.Map:
+		m, ok := value.(Map)
+		if !ok {
+			return mismatch("MAP")
+		}
+
+		result := reflect.MakeMapWithSize(t, len(m.Elements))
+
+		for key, elem := range m.Elements {
+			converted, err := toGo(elem, t.Elem())
+			if err != nil {
+				return reflect.Value{}, nested(err, fmt.Sprintf("[%q]", key))
+			}
+
+			result.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), converted)
+		}
+
+		return result, nil
+
+	case reflect.Struct:
+		m, ok := value.(Map)
+		if !ok {
+			return mismatch("MAP")
+		}
+
+		result := reflect.New(t).Elem()
+
+		for idx := range t.NumField() {
+			key, _, ok := fieldKey(t.Field(idx))
+			if !ok {
+				continue
+			}
+
+			elem, ok := m.Elements[key]
+			if !ok {
+				continue
+			}
+
+			converted, err := toGo(elem, t.Field(idx).Type)
+			if err != nil {
+				return reflect.Value{}, nested(err, "."+key)
+			}
+
+			result.Field(idx).Set(converted)
+		}
+
+		return result, nil
+
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// toNative converts a Tatu value to its natural Go value: float64, string, bool, nil, []any or map[string]any.
+func toNative(value Value) (any, error) {
+	switch v := value.(type) {
+	case Nil:
+		return nil, nil
+	case Bool:
+		return v.Value, nil
+	case Number:
+		return v.Value, nil
+	case String:
+		return v.Value, nil
+	case *Vector:
+		result := make([]any, len(v.Elements))
+
+		for idx, elem := range v.Elements {
+			native, err := toNative(elem)
+			if err != nil {
+				return nil, nested(err, fmt.Sprintf("[%d]", idx))
+			}
+
+			result[idx] = native
+		}
+
+		return result, nil
+	case Map:
+		result := make(map[string]any, len(v.Elements))
+
+		for key, elem := range v.Elements {
+			native, err := toNative(elem)
+			if err != nil {
+				return nil, nested(err, fmt.Sprintf("[%q]", key))
+			}
+
+			result[key] = native
+		}
+
+		return result, nil
+	default:
+		return nil, &ConversionError{Expected: "NIL, BOOL, NUMBER, STRING, VECTOR or MAP", Found: value.Type().String()}
+	}
+}
+
+// nested prefixes the position of a nested value to a conversion error.
+func nested(err error, path string) error {
+	var convErr *ConversionError
+
+	if errors.As(err, &convErr) {
+		convErr.Path = path + convErr.Path
+	}
+
+	return err
+}
+
+// fitsInteger checks if a number is within the range of an integer value.
+func fitsInteger(value reflect.Value, n float64) bool {
+	if value.CanInt() {
+		return n >= math.MinInt64 && n < math.MaxInt64 && !value.OverflowInt(int64(n))
+	}
+
+	return n >= 0 && n < math.MaxUint64 && !value.OverflowUint(uint64(n))
+}
+
+// fieldKey returns the map key of an exported struct field and whether zero values are omitted.
+// The key is the name of its `tatu` tag or, without one, its name starting in lower case, e.g. `userName` for `UserName`.
+func fieldKey(field reflect.StructField) (string, bool, bool) {
+	if !field.IsExported() {
+		return "", false, false
+	}
+
+	tag := field.Tag.Get("tatu")
+	if tag == "-" {
+		return "", false, false
+	}
+
+	name, options, _ := strings.Cut(tag, ",")
+	omitEmpty := options == "omitempty"
+
+	if name != "" {
+		return name, omitEmpty, true
+	}
+
+	r, size := utf8.DecodeRuneInString(field.Name)
+
+	return string(unicode.ToLower(r)) + field.Name[size:], omitEmpty, true
+}
@@ -8,10 +8,14 @@ type Binding struct {
 	Native bool
 }
 
+// Module registers a group of natives in a global scope, e.g. `stdlib.RegisterString`.
+type Module func(env *Environment)
+
 // Environment is the symbol table that manages variable scoping.
 type Environment struct {
 	record map[string]Binding
 	parent *Environment
+	memory *Memory // only set in the global scope
 }
 
 // NewEnvironment builds a new Environment.
@@ -20,10 +24,16 @@ func NewEnvironment(record map[string]Binding, parent *Environment) *Environment
 		record = make(map[string]Binding)
 	}
 
-	return &Environment{
+	env := &Environment{
 		record: record,
 		parent: parent,
 	}
+
+	if parent == nil {
+		env.memory = &Memory{}
+	}
+
+	return env
 }
 
 // Define defines a new user binding in the current scope.
@@ -78,6 +88,25 @@ func (env *Environment) Lookup(name string) (Value, bool) {
 	return nil, false
 }
 
+// Parent returns the enclosing scope.
+func (env *Environment) Parent() *Environment {
+	return env.parent
+}
+
+// Memory returns the allocation accounting shared by the whole scope chain.
+func (env *Environment) Memory() *Memory {
+	for env.parent != nil {
+		env = env.parent
+	}
+
+	return env.memory
+}
+
+// IsNative checks if the name is bound to a runtime-provided value in the current or parent scope.
+func (env *Environment) IsNative(name string) bool {
+	return env.hasNative(name)
+}
+
 // Variables returns the user-defined variables in this scope.
 func (env *Environment) Variables() map[string]Value {
 	out := make(map[string]Value, len(env.record))
@@ -91,6 +120,19 @@ func (env *Environment) Variables() map[string]Value {
 	return out
 }
 
+// Natives returns the runtime-provided bindings in this scope.
+func (env *Environment) Natives() map[string]Value {
+	out := make(map[string]Value, len(env.record))
+
+	for name, b := range env.record {
+		if b.Native {
+			out[name] = b.Value
+		}
+	}
+
+	return out
+}
+
 // hasNative checks for a native binding in the current or parent scope.
 func (env *Environment) hasNative(name string) bool {
 	if b, ok := env.record[name]; ok && b.Native {
@@ -0,0 +1,77 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/danielspk/tatu-lang/pkg/debug"
+)
+
+// valueSize is the approximate number of bytes taken by a value held in a collection.
+const valueSize = 16
+
+// MemoryLimits caps what a script can allocate. Zero values mean no limit.
+type MemoryLimits struct {
+	MaxStringLength   int // bytes of a single string
+	MaxCollectionSize int // elements of a single vector or map
+	MaxAllocation     int // approximate bytes allocated by an evaluation
+}
+
+// Memory accounts the approximate allocations of strings and collections against its limits.
+type Memory struct {
+	limits    MemoryLimits
+	allocated int
+}
+
+// SetLimits replaces the memory limits.
+func (m *Memory) SetLimits(limits MemoryLimits) {
+	m.limits = limits
+}
+
+// Limits returns the memory limits.
+func (m *Memory) Limits() MemoryLimits {
+	return m.limits
+}
+
+// Reset clears the allocation count, e.g. before a new evaluation.
+func (m *Memory) Reset() {
+	m.allocated = 0
+}
+
+// Allocated returns the approximate number of bytes allocated since the last reset, when MaxAllocation is set.
+func (m *Memory) Allocated() int {
+	return m.allocated
+}
+
+// AllocString accounts a new string of the given length in bytes. Called before building the string when its
+// length is known in advance, oversized strings are never allocated; otherwise it is called right after.
+func (m *Memory) AllocString(length int) error {
+	if m.limits.MaxStringLength > 0 && length > m.limits.MaxStringLength {
+		return debug.NewMemoryLimitError(fmt.Sprintf("string length of %d bytes exceeds the limit of %d", length, m.limits.MaxStringLength))
+	}
+
+	return m.charge(length)
+}
+
+// AllocElements accounts the elements added to a vector or map that ends up with the given size.
+func (m *Memory) AllocElements(size, added int) error {
+	if m.limits.MaxCollectionSize > 0 && size > m.limits.MaxCollectionSize {
+		return debug.NewMemoryLimitError(fmt.Sprintf("collection size of %d elements exceeds the limit of %d", size, m.limits.MaxCollectionSize))
+	}
+
+	return m.charge(added * valueSize)
+}
+
+// charge adds bytes to the allocation count. Allocations are only counted when they are limited.
+func (m *Memory) charge(bytes int) error {
+	if m.limits.MaxAllocation <= 0 {
+		return nil
+	}
+
+	m.allocated += bytes
+
+	if m.allocated > m.limits.MaxAllocation {
+		return debug.NewMemoryLimitError(fmt.Sprintf("allocation limit of %d bytes exceeded", m.limits.MaxAllocation))
+	}
+
+	return nil
+}
@@ -320,14 +320,40 @@ func (uf Function) Equal(_ Value) bool {
 	return false
 }
 
+// Caller calls a function value, native or defined by a script, on the backend running a native function.
+type Caller func(fn Value, args ...Value) (Value, error)
+
 // NativeFunction represents a native function value.
+// Natives that call back functions received as arguments, e.g. `vec:map`, also have a Callback,
+// which the backends call instead of Value with a Caller.
 type NativeFunction struct {
-	Value func(args ...Value) (Value, error)
+	Value    func(args ...Value) (Value, error)
+	Callback func(call Caller, args ...Value) (Value, error)
 }
 
 // NewNativeFunction builds a new NativeFunction.
 func NewNativeFunction(value func(args ...Value) (Value, error)) NativeFunction {
-	return NativeFunction{value}
+	return NativeFunction{Value: value}
+}
+
+// NewCallbackFunction builds a new NativeFunction that calls back functions through the Caller of the backend.
+// Its Value, used without a backend, can only call back native functions.
+func NewCallbackFunction(callback func(call Caller, args ...Value) (Value, error)) NativeFunction {
+	return NativeFunction{
+		Value: func(args ...Value) (Value, error) {
+			return callback(callNative, args...)
+		},
+		Callback: callback,
+	}
+}
+
+// Call calls the native function, giving the Caller to the natives that call back functions.
+func (f NativeFunction) Call(call Caller, args ...Value) (Value, error) {
+	if f.Callback != nil {
+		return f.Callback(call, args...)
+	}
+
+	return f.Value(args...)
 }
 
 // Type returns the type of the native function value.
@@ -345,6 +371,16 @@ func (f NativeFunction) Equal(_ Value) bool {
 	return false
 }
 
+// callNative is the Caller of native functions used without a backend, which cannot call script functions.
+func callNative(fn Value, args ...Value) (Value, error) {
+	native, ok := fn.(NativeFunction)
+	if !ok {
+		return nil, fmt.Errorf("cannot call %s without an evaluator", fn.Type())
+	}
+
+	return native.Call(callNative, args...)
+}
+
 // RecurBindings represents a tail-call marker value for TCO.
 type RecurBindings struct {
 	Args []Value
@@ -34,11 +34,33 @@ type Scanner struct {
 	start    cursor
 	current  cursor
 	tokens   []token.Token
+	trivia   bool
+	leading  []token.Trivia // trivia scanned for the next token
+	trailing bool           // trivia goes to the previous token, until the end of its line
+}
+
+// Option configures a Scanner.
+type Option func(s *Scanner)
+
+// WithTrivia attaches the whitespaces, newlines and comments to the tokens as trivia, so the tokens keep the whole
+// source, e.g. for a concrete syntax tree. The trivia following a token in its line, including the newline, is trailing
+// to that token and the rest is leading to the next one. The EOF token leads with the trivia at the end of the source.
+// The comments are only kept as trivia, e.g. for a formatter.
+func WithTrivia() Option {
+	return func(s *Scanner) {
+		s.trivia = true
+	}
 }
 
 // NewScanner builds a new Scanner.
-func NewScanner() *Scanner {
-	return &Scanner{}
+func NewScanner(opts ...Option) *Scanner {
+	s := &Scanner{}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // Scan tokenizes the source code to generate a slice of tokens.
@@ -48,6 +70,8 @@ func (s *Scanner) Scan(source []byte, filename string) ([]token.Token, error) {
 	s.start = cursor{offset: 0, line: 1, column: 1}
 	s.current = cursor{offset: 0, line: 1, column: 1}
 	s.tokens = make([]token.Token, 0)
+	s.leading = nil
+	s.trailing = false
 
 	for !s.isAtEnd() {
 		if err := s.scanToken(); err != nil {
@@ -66,6 +90,13 @@ func (s *Scanner) scanToken() error {
 
 	chr := s.advance()
 
+	if s.trivia {
+		if kind, ok := s.readTrivia(chr); ok {
+			s.addTrivia(kind)
+			return nil
+		}
+	}
+
 	switch chr {
 	case ' ', '\t', '\r':
 		return nil
@@ -241,28 +272,79 @@ func (s *Scanner) addToken(tokenType token.Type) error {
 		return err
 	}
 
-	s.tokens = append(s.tokens, token.NewToken(
-		tokenType,
-		lexeme,
-		literal,
-		location.NewLocation(s.filename,
-			location.NewPosition(
-				s.start.line,
-				s.start.column,
-				s.start.offset),
-			location.NewPosition(
-				s.current.line,
-				s.current.column,
-				s.current.offset),
-		),
-	))
+	tok := token.NewToken(tokenType, lexeme, literal, s.currentLocation())
+
+	if s.trivia {
+		tok.Leading, s.leading = s.leading, nil
+		s.trailing = true
+	}
+
+	s.tokens = append(s.tokens, tok)
 
 	return nil
 }
 
-// readComment advances positions until you finish reading a comment.
+// currentLocation gets the location of the current lexeme.
+func (s *Scanner) currentLocation() location.Location {
+	return location.NewLocation(s.filename,
+		location.NewPosition(
+			s.start.line,
+			s.start.column,
+			s.start.offset),
+		location.NewPosition(
+			s.current.line,
+			s.current.column,
+			s.current.offset),
+	)
+}
+
+// addTrivia adds the current lexeme as trailing trivia of the previous token or as leading trivia of the next one.
+func (s *Scanner) addTrivia(kind token.TriviaKind) {
+	trivia := token.Trivia{Kind: kind, Text: s.currentLexeme(), Location: s.currentLocation()}
+
+	if !s.trailing {
+		s.leading = append(s.leading, trivia)
+		return
+	}
+
+	last := &s.tokens[len(s.tokens)-1]
+	last.Trailing = append(last.Trailing, trivia)
+
+	// the trailing trivia ends with the line
+	s.trailing = kind != token.NewlineTrivia
+}
+
+// readTrivia advances positions until you finish reading a whitespace, a newline or a comment that starts with a
+// character, reporting its kind.
+func (s *Scanner) readTrivia(chr rune) (token.TriviaKind, bool) {
+	switch {
+	case chr == '\r' && s.peek() == '\n':
+		_ = s.advance()
+		fallthrough
+
+	case chr == '\n':
+		s.current.line++
+		s.current.column = 1
+		return token.NewlineTrivia, true
+
+	case chr == ' ' || chr == '\t' || chr == '\r':
+		for next := s.peek(); next == ' ' || next == '\t' || next == '\r' && s.lookAhead() != '\n'; next = s.peek() {
+			_ = s.advance()
+		}
+
+		return token.WhitespaceTrivia, true
+
+	case chr == ';':
+		s.readComment()
+		return token.CommentTrivia, true
+	}
+
+	return 0, false
+}
+
+// readComment advances positions until you finish reading a comment, before a "\n" or "\r\n" newline.
 func (s *Scanner) readComment() {
-	for !s.isAtEnd() && s.peek() != '\n' {
+	for !s.isAtEnd() && s.peek() != '\n' && (s.peek() != '\r' || s.lookAhead() != '\n') {
 		_ = s.advance()
 	}
 }
@@ -361,9 +443,10 @@ func (s *Scanner) isSymbol(r rune) bool {
 // error makes an error.
 func (s *Scanner) error(msg string) *debug.Error {
 	return &debug.Error{
-		Msg:    msg,
-		Line:   s.current.line,
-		Column: s.current.column,
-		File:   s.filename,
+		Msg:      msg,
+		Line:     s.current.line,
+		Column:   s.current.column,
+		File:     s.filename,
+		Location: s.currentLocation(),
 	}
 }
@@ -17,15 +17,34 @@ const (
 	Bool                       // "true" | "false"
 	Nil                        // "nil"
 	Symbol                     // alphanumeric | operators
-	EOF
+	EOF                        // end of the source
 )
 
+// TriviaKind represents a kind of trivia.
+type TriviaKind uint8
+
+// Trivia kinds.
+const (
+	WhitespaceTrivia TriviaKind = iota + 1 // spaces and tabs
+	NewlineTrivia                          // "\n" | "\r\n"
+	CommentTrivia                          // ; ...
+)
+
+// Trivia represents the source between tokens, only scanned with scanner.WithTrivia.
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+	location.Location
+}
+
 // Token represents a token extracted from the Lexer tokenization.
 type Token struct {
 	Type    Type
 	Lexeme  string
 	Literal any
 	location.Location
+	Leading  []Trivia // trivia before the token, from the line after the previous token
+	Trailing []Trivia // trivia after the token until the end of its line, including the newline
 }
 
 // NewToken builds a new Token.
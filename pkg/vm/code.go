@@ -0,0 +1,97 @@
+package vm
+
+import (
+	"sort"
+
+	"github.com/danielspk/tatu-lang/pkg/location"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+// Line maps the instructions starting at an offset to the source location that generated them.
+type Line struct {
+	Offset   int
+	Location location.Location
+}
+
+// Capture describes where a closure takes a captured variable from when it is created.
+type Capture struct {
+	Name  string
+	Local bool // a slot of the enclosing frame, otherwise a captured variable of the enclosing closure
+	Index int
+}
+
+// Code represents a compiled unit of bytecode: the main program or a function body.
+type Code struct {
+	Name      string
+	Params    []string
+	Locals    []string  // names of the frame slots, starting with the parameters
+	Upvalues  []Capture // variables captured from the enclosing functions
+	Constants []runtime.Value
+	Functions []*Code
+	Code      []byte
+	Lines     []Line
+}
+
+// NewCode builds a new Code.
+func NewCode(name string) *Code {
+	return &Code{
+		Name:      name,
+		Params:    make([]string, 0),
+		Locals:    make([]string, 0),
+		Upvalues:  make([]Capture, 0),
+		Constants: make([]runtime.Value, 0),
+		Functions: make([]*Code, 0),
+		Code:      make([]byte, 0),
+		Lines:     make([]Line, 0),
+	}
+}
+
+// LocationAt returns the source location of the instruction at an offset.
+func (c *Code) LocationAt(offset int) (location.Location, bool) {
+	idx := sort.Search(len(c.Lines), func(i int) bool {
+		return c.Lines[i].Offset > offset
+	})
+
+	if idx == 0 {
+		return location.Location{}, false
+	}
+
+	return c.Lines[idx-1].Location, true
+}
+
+// addLine records the location of the instruction at an offset when it differs from the previous one.
+func (c *Code) addLine(offset int, loc location.Location) {
+	if len(c.Lines) > 0 && c.Lines[len(c.Lines)-1].Location == loc {
+		return
+	}
+
+	c.Lines = append(c.Lines, Line{Offset: offset, Location: loc})
+}
+
+// maxOperand returns the largest value that fits in an operand of the given width.
+func maxOperand(width int) int {
+	return 1<<(8*width) - 1
+}
+
+// encodeOperand encodes a big-endian operand of the given width.
+func encodeOperand(value int, width int) []byte {
+	operand := make([]byte, width)
+
+	for idx := width - 1; idx >= 0; idx-- {
+		operand[idx] = byte(value)
+		value >>= 8
+	}
+
+	return operand
+}
+
+// readOperand decodes a big-endian operand of the given width.
+func readOperand(code []byte, width int) int {
+	value := 0
+
+	for idx := 0; idx < width; idx++ {
+		value = value<<8 | int(code[idx])
+	}
+
+	return value
+}
@@ -1,113 +1,687 @@
 package vm
 
 import (
+	"fmt"
+	"math"
+
 	"github.com/danielspk/tatu-lang/pkg/ast"
+	"github.com/danielspk/tatu-lang/pkg/debug"
+	"github.com/danielspk/tatu-lang/pkg/location"
 	"github.com/danielspk/tatu-lang/pkg/runtime"
 )
 
-// Code ...
-type Code struct {
-	Constants []runtime.Value
-	Code      []byte
+// constantKey identifies a constant of the pool for deduplication.
+type constantKey struct {
+	kind runtime.ValueType
+	bits uint64
+	str  string
+}
+
+// local is a variable of the function being compiled, bound to a frame slot.
+type local struct {
+	name    string
+	depth   int
+	slot    int
+	pending bool // declared by a `var` of the block that is not compiled yet
+}
+
+// function holds the state of a function being compiled.
+type function struct {
+	code      *Code
+	constants map[constantKey]int
+	locals    []local // variables in scope, innermost last
+	depth     int     // scope depth: 0 is the global scope of the main program
+	enclosing *function
 }
 
-// NewCode ...
-func NewCode(name string) Code {
-	return Code{
-		Constants: make([]runtime.Value, 0),
-		Code:      make([]byte, 0),
+// newFunction builds the compilation state of a function.
+func newFunction(name string, depth int, enclosing *function) *function {
+	return &function{
+		code:      NewCode(name),
+		constants: make(map[constantKey]int),
+		locals:    make([]local, 0),
+		depth:     depth,
+		enclosing: enclosing,
 	}
 }
 
-// Compiler ...
+// Compiler is responsible for lowering the AST into bytecode.
 type Compiler struct {
-	code *Code
+	fn       *function
+	optimize bool
+	natives  *runtime.Environment // global scope of the modules the program runs with
+	globals  map[string]bool      // names of the globals the program defines
 }
 
-// NewCompiler ...
-func NewCompiler() Compiler {
-	return Compiler{
-		code: &Code{},
+// CompilerOption configures a Compiler.
+type CompilerOption func(c *Compiler)
+
+// WithOptimizations enables constant folding, dead branch elimination and peephole optimizations.
+// Folding only applies the arithmetic and comparison natives registered by the modules the program runs with,
+// every one (profile.Full) when none is given, e.g. the same ones given to WithModules.
+func WithOptimizations(modules ...runtime.Module) CompilerOption {
+	return func(c *Compiler) {
+		c.optimize = true
+		c.natives = NewEnvironment(modules...)
 	}
 }
 
-// Compile ...
-func (c *Compiler) Compile(ast *ast.AST) *Code {
-	for _, expr := range ast.Program {
-		c.generate(expr)
+// NewCompiler builds a new Compiler.
+func NewCompiler(opts ...CompilerOption) Compiler {
+	c := Compiler{}
+
+	for _, opt := range opts {
+		opt(&c)
 	}
 
-	c.code.Code = append(c.code.Code, byte(OpHalt))
+	return c
+}
+
+// Compile compiles a whole program. The resulting code leaves the value of the last expression on the stack.
+func (c *Compiler) Compile(program *ast.AST) (*Code, error) {
+	c.fn = newFunction("main", 0, nil)
+	c.globals = make(map[string]bool)
+
+	for _, expr := range program.Program {
+		if c.isForm(expr, "var") {
+			c.globals[expr.(*ast.ListExpr).List[1].(*ast.SymbolExpr).Symbol] = true
+		}
+	}
+
+	var loc location.Location
+
+	if len(program.Program) == 0 {
+		c.emit(loc, OpNil)
+	}
+
+	for idx, expr := range program.Program {
+		if idx > 0 {
+			c.emit(loc, OpPop)
+		}
+
+		loc = expr.Location()
+
+		if err := c.generate(expr); err != nil {
+			return nil, err
+		}
+	}
+
+	c.emit(loc, OpHalt)
+
+	if c.optimize {
+		optimize(c.fn.code)
+	}
+
+	return c.fn.code, nil
+}
+
+// CompileExpr compiles a single top-level expression.
+func (c *Compiler) CompileExpr(expr ast.SExpr) (*Code, error) {
+	return c.Compile(&ast.AST{Program: []ast.SExpr{expr}})
+}
+
+// generate emits the bytecode of an S-expression in non-tail position.
+func (c *Compiler) generate(expr ast.SExpr) error {
+	return c.generateExpr(expr, false)
+}
 
-	return c.code
+// generateInTailPosition emits the bytecode of an S-expression in tail position of a function.
+func (c *Compiler) generateInTailPosition(expr ast.SExpr) error {
+	return c.generateExpr(expr, true)
 }
 
-// generate ...
-func (c *Compiler) generate(expr ast.SExpr) {
+// generateExpr emits the bytecode of an S-expression.
+// Note: the format of the S-expressions is guaranteed by the syntax analyzer.
+func (c *Compiler) generateExpr(expr ast.SExpr, tail bool) error {
 	switch expr.Kind() {
 	case ast.NumberKind:
-		c.code.Code = append(c.code.Code, byte(OpConst))
-		c.code.Code = append(c.code.Code, c.addNumberConstant(expr.(*ast.NumberExpr).Number))
+		return c.emitConstant(runtime.NewNumber(expr.(*ast.NumberExpr).Number), expr.Location())
 
 	case ast.StringKind:
-		c.code.Code = append(c.code.Code, byte(OpConst))
-		c.code.Code = append(c.code.Code, c.addStringConstant(expr.(*ast.StringExpr).String))
+		return c.emitConstant(runtime.NewString(expr.(*ast.StringExpr).String), expr.Location())
+
+	case ast.BoolKind:
+		if expr.(*ast.BoolExpr).Bool {
+			c.emit(expr.Location(), OpTrue)
+		} else {
+			c.emit(expr.Location(), OpFalse)
+		}
+
+		return nil
 
-	case ast.BoolKind, ast.SymbolKind, ast.NilKind:
+	case ast.NilKind:
+		c.emit(expr.Location(), OpNil)
+		return nil
+
+	case ast.SymbolKind:
+		return c.emitVariable(expr.(*ast.SymbolExpr).Symbol, false, expr.Location())
 
 	case ast.ListKind:
-		if len(expr.(*ast.ListExpr).List) == 0 {
-			// TODO nil support
-			return
+		if c.optimize {
+			if value, ok := c.fold(expr); ok {
+				return c.emitValue(value, expr.Location())
+			}
 		}
 
-		switch expr.(*ast.ListExpr).List[0].Kind() {
-		case ast.SymbolKind:
-			// TODO ...
-		default:
-			// TODO ...
-		}
+		return c.generateList(expr.(*ast.ListExpr), tail)
 
 	default:
-		// TODO ...
-		//return nil, i.error("unknown expression", expr.End.Line, expr.End.Column)
+		return c.error("unknown expression type", expr.Location())
 	}
 }
 
-// addNumberConstant adds a number constant and returns the new constant index
-func (c *Compiler) addNumberConstant(value float64) byte {
-	for idx, constant := range c.code.Constants {
-		if constant.Type() != runtime.NumberType {
-			continue
+// generateList emits the bytecode of a list expression.
+func (c *Compiler) generateList(expr *ast.ListExpr, tail bool) error {
+	if len(expr.List) == 0 {
+		c.emit(expr.Location(), OpNil)
+		return nil
+	}
+
+	if expr.List[0].Kind() == ast.SymbolKind {
+		switch expr.List[0].(*ast.SymbolExpr).Symbol {
+		case "and", "or":
+			return c.generateLogical(expr)
+		case "block":
+			return c.generateBlock(expr, tail)
+		case "var":
+			return c.generateVar(expr)
+		case "set":
+			return c.generateSet(expr)
+		case "if":
+			return c.generateIf(expr, tail)
+		case "while":
+			return c.generateWhile(expr)
+		case "lambda":
+			return c.generateLambda(expr, "lambda")
+		case "recur":
+			return c.generateRecur(expr, tail)
+		case "vector":
+			return c.generateVector(expr)
+		case "map":
+			return c.generateMap(expr)
+		}
+	}
+
+	return c.generateCall(expr)
+}
+
+// generateLogical emits the `and` and `or` logical special forms.
+func (c *Compiler) generateLogical(expr *ast.ListExpr) error {
+	op, result := OpAnd, OpTrue
+	if expr.List[0].(*ast.SymbolExpr).Symbol == "or" {
+		op, result = OpOr, OpFalse
+	}
+
+	jumps := make([]int, 0, len(expr.List)-1)
+
+	for _, e := range expr.List[1:] {
+		if err := c.generate(e); err != nil {
+			return err
+		}
+
+		jumps = append(jumps, c.emitJump(op, e.Location()))
+	}
+
+	c.emit(expr.Location(), result)
+
+	for _, jump := range jumps {
+		if err := c.patchJump(jump, expr.Location()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generateBlock emits a `block` expression (block of expressions).
+func (c *Compiler) generateBlock(expr *ast.ListExpr, tail bool) error {
+	first, scope := len(c.fn.code.Locals), len(c.fn.locals)
+	c.fn.depth++
+
+	// the closures of the block can refer to the variables declared after them
+	for _, e := range expr.List[1:] {
+		if c.isForm(e, "var") {
+			c.fn.reserve(e.(*ast.ListExpr).List[1].(*ast.SymbolExpr).Symbol)
+		}
+	}
+
+	last := len(expr.List) - 2
+
+	for idx, e := range expr.List[1:] {
+		if idx > 0 {
+			c.emit(expr.Location(), OpPop)
 		}
 
-		if constant.(runtime.Number).Value == value {
-			return byte(idx)
+		if err := c.generateExpr(e, tail && idx == last); err != nil {
+			return err
 		}
 	}
 
-	// TODO overflow?
+	c.fn.depth--
+	c.fn.locals = c.fn.locals[:scope]
 
-	c.code.Constants = append(c.code.Constants, runtime.NewNumber(value))
+	if count := len(c.fn.code.Locals) - first; count > 0 {
+		c.emit(expr.Location(), OpExitScope, append(encodeOperand(first, localWidth), encodeOperand(count, localWidth)...)...)
+	}
 
-	return byte(len(c.code.Constants) - 1)
+	return nil
 }
 
-// addStringConstant ...
-func (c *Compiler) addStringConstant(value string) byte {
-	for idx, constant := range c.code.Constants {
-		if constant.Type() != runtime.StringType {
-			continue
+// generateVar emits a `var` expression. Variables of the main program scope are global, the rest live in frame slots.
+func (c *Compiler) generateVar(expr *ast.ListExpr) error {
+	name := expr.List[1].(*ast.SymbolExpr)
+
+	if c.fn.depth == 0 {
+		if err := c.generateNamed(expr.List[2], name.Symbol); err != nil {
+			return err
 		}
 
-		if constant.(runtime.String).Value == value {
-			return byte(idx)
+		return c.emitName(OpDefineGlobal, name.Symbol, name.Location())
+	}
+
+	// a lambda sees its own binding, any other value sees the enclosing one (e.g. `(var i i)`)
+	var slot int
+
+	if c.isForm(expr.List[2], "lambda") {
+		slot = c.fn.declare(name.Symbol)
+	}
+
+	if err := c.generateNamed(expr.List[2], name.Symbol); err != nil {
+		return err
+	}
+
+	if !c.isForm(expr.List[2], "lambda") {
+		slot = c.fn.declare(name.Symbol)
+	}
+
+	return c.emitOperand(OpDefineLocal, slot, localWidth, "locals", name.Location())
+}
+
+// generateSet emits a `set` expression.
+func (c *Compiler) generateSet(expr *ast.ListExpr) error {
+	name := expr.List[1].(*ast.SymbolExpr)
+
+	if err := c.generateNamed(expr.List[2], name.Symbol); err != nil {
+		return err
+	}
+
+	return c.emitVariable(name.Symbol, true, name.Location())
+}
+
+// generateNamed emits the value of a binding, naming it when it is a lambda.
+func (c *Compiler) generateNamed(expr ast.SExpr, name string) error {
+	if c.isForm(expr, "lambda") {
+		return c.generateLambda(expr.(*ast.ListExpr), name)
+	}
+
+	return c.generate(expr)
+}
+
+// generateIf emits an `if` expression.
+func (c *Compiler) generateIf(expr *ast.ListExpr, tail bool) error {
+	if c.optimize {
+		// only the taken branch of a literal condition is emitted
+		if value, ok := c.fold(expr.List[1]); ok && value.Type() == runtime.BoolType {
+			switch {
+			case value.(runtime.Bool).Value:
+				return c.generateExpr(expr.List[2], tail)
+			case len(expr.List) == 4:
+				return c.generateExpr(expr.List[3], tail)
+			default:
+				c.emit(expr.Location(), OpNil)
+				return nil
+			}
+		}
+	}
+
+	if err := c.generate(expr.List[1]); err != nil {
+		return err
+	}
+
+	elseJump := c.emitJump(OpJumpIfFalse, expr.List[1].Location())
+
+	if err := c.generateExpr(expr.List[2], tail); err != nil {
+		return err
+	}
+
+	endJump := c.emitJump(OpJump, expr.Location())
+
+	if err := c.patchJump(elseJump, expr.Location()); err != nil {
+		return err
+	}
+
+	if len(expr.List) == 4 {
+		if err := c.generateExpr(expr.List[3], tail); err != nil {
+			return err
 		}
+	} else {
+		c.emit(expr.Location(), OpNil)
 	}
 
-	// TODO overflow?
+	return c.patchJump(endJump, expr.Location())
+}
+
+// generateWhile emits a `while` expression. The value of the last iteration is left on the stack.
+func (c *Compiler) generateWhile(expr *ast.ListExpr) error {
+	c.emit(expr.Location(), OpNil)
+
+	loopStart := len(c.fn.code.Code)
+
+	if err := c.generate(expr.List[1]); err != nil {
+		return err
+	}
+
+	exitJump := c.emitJump(OpJumpIfFalse, expr.List[1].Location())
+
+	c.emit(expr.Location(), OpPop)
+
+	if err := c.generate(expr.List[2]); err != nil {
+		return err
+	}
 
-	c.code.Constants = append(c.code.Constants, runtime.NewString(value))
+	if err := c.emitJumpTo(OpJump, loopStart, expr.Location()); err != nil {
+		return err
+	}
+
+	return c.patchJump(exitJump, expr.Location())
+}
+
+// generateLambda emits a `lambda` expression as a nested function.
+func (c *Compiler) generateLambda(expr *ast.ListExpr, name string) error {
+	fn := newFunction(name, 1, c.fn)
+
+	for _, param := range expr.List[1].(*ast.ListExpr).List {
+		fn.code.Params = append(fn.code.Params, param.(*ast.SymbolExpr).Symbol)
+		fn.bind(param.(*ast.SymbolExpr).Symbol)
+	}
+
+	c.fn = fn
+
+	if err := c.generateInTailPosition(expr.List[2]); err != nil {
+		c.fn = fn.enclosing
+		return err
+	}
+
+	c.emit(expr.List[2].Location(), OpReturn)
+
+	c.fn = fn.enclosing
+
+	c.fn.code.Functions = append(c.fn.code.Functions, fn.code)
+
+	return c.emitOperand(OpClosure, len(c.fn.code.Functions)-1, functionWidth, "functions", expr.Location())
+}
 
-	return byte(len(c.code.Constants) - 1)
+// generateRecur emits a `recur` expression as a jump to the start of the current function.
+func (c *Compiler) generateRecur(expr *ast.ListExpr, tail bool) error {
+	if !tail {
+		return c.error("recur can only be used in tail position of a function", expr.Location())
+	}
+
+	if err := c.generateValues(expr.List[1:]); err != nil {
+		return err
+	}
+
+	return c.emitCount(OpRecur, len(expr.List)-1, expr.Location())
+}
+
+// generateVector emits a `vector` expression.
+func (c *Compiler) generateVector(expr *ast.ListExpr) error {
+	if err := c.generateValues(expr.List[1:]); err != nil {
+		return err
+	}
+
+	return c.emitCount(OpVector, len(expr.List)-1, expr.Location())
+}
+
+// generateMap emits a `map` expression.
+func (c *Compiler) generateMap(expr *ast.ListExpr) error {
+	if err := c.generateValues(expr.List[1:]); err != nil {
+		return err
+	}
+
+	return c.emitCount(OpMap, (len(expr.List)-1)/2, expr.Location())
+}
+
+// generateCall emits a call function expression.
+func (c *Compiler) generateCall(expr *ast.ListExpr) error {
+	if err := c.generateValues(expr.List); err != nil {
+		return err
+	}
+
+	return c.emitCount(OpCall, len(expr.List)-1, expr.Location())
+}
+
+// generateValues emits a list of expressions leaving every value on the stack.
+func (c *Compiler) generateValues(exprs []ast.SExpr) error {
+	for _, e := range exprs {
+		if err := c.generate(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isForm checks if the expression is a list headed by the given symbol.
+func (c *Compiler) isForm(expr ast.SExpr, symbol string) bool {
+	list, ok := expr.(*ast.ListExpr)
+	if !ok || len(list.List) == 0 {
+		return false
+	}
+
+	head, ok := list.List[0].(*ast.SymbolExpr)
+
+	return ok && head.Symbol == symbol
+}
+
+// emit appends an instruction with its operands, recording the source location that generated it.
+func (c *Compiler) emit(loc location.Location, op opcode, operands ...byte) {
+	c.fn.code.addLine(len(c.fn.code.Code), loc)
+	c.fn.code.Code = append(c.fn.code.Code, byte(op))
+	c.fn.code.Code = append(c.fn.code.Code, operands...)
+}
+
+// emitOperand emits an instruction with a single operand of the given width, failing if the value does not fit.
+func (c *Compiler) emitOperand(op opcode, value int, width int, what string, loc location.Location) error {
+	if value > maxOperand(width) {
+		return c.error(fmt.Sprintf("too many %s: %d (limit %d)", what, value, maxOperand(width)), loc)
+	}
+
+	c.emit(loc, op, encodeOperand(value, width)...)
+
+	return nil
+}
+
+// emitConstant emits an instruction that pushes a constant, using a wide index when the short one overflows.
+func (c *Compiler) emitConstant(value runtime.Value, loc location.Location) error {
+	idx := c.addConstant(value)
+
+	if idx <= maxOperand(constWidth) {
+		return c.emitOperand(OpConst, idx, constWidth, "constants", loc)
+	}
+
+	return c.emitOperand(OpConstLong, idx, constLongWidth, "constants", loc)
+}
+
+// emitName emits an instruction whose operand is the name of a binding.
+func (c *Compiler) emitName(op opcode, name string, loc location.Location) error {
+	return c.emitOperand(op, c.addConstant(runtime.NewString(name)), nameWidth, "constants", loc)
+}
+
+// emitVariable emits the read or the assignment of a variable, resolved as a frame slot, a captured variable or a global.
+func (c *Compiler) emitVariable(name string, set bool, loc location.Location) error {
+	if slot, ok := c.fn.resolveLocal(name, false); ok {
+		if set {
+			return c.emitOperand(OpSetLocal, slot, localWidth, "locals", loc)
+		}
+
+		return c.emitOperand(OpGetLocal, slot, localWidth, "locals", loc)
+	}
+
+	if idx, ok := c.fn.resolveUpvalue(name); ok {
+		if set {
+			return c.emitOperand(OpSetUpvalue, idx, upvalueWidth, "upvalues", loc)
+		}
+
+		return c.emitOperand(OpGetUpvalue, idx, upvalueWidth, "upvalues", loc)
+	}
+
+	if set {
+		return c.emitName(OpSetGlobal, name, loc)
+	}
+
+	return c.emitName(OpGetGlobal, name, loc)
+}
+
+// emitCount emits an instruction whose operand is a count of stack values.
+func (c *Compiler) emitCount(op opcode, count int, loc location.Location) error {
+	width, what := countWidth, "elements"
+	if op == OpCall || op == OpRecur {
+		width, what = argsWidth, "arguments"
+	}
+
+	return c.emitOperand(op, count, width, what, loc)
+}
+
+// emitJump emits a jump instruction with a placeholder offset and returns the operand position.
+func (c *Compiler) emitJump(op opcode, loc location.Location) int {
+	c.emit(loc, op, make([]byte, jumpWidth)...)
+
+	return len(c.fn.code.Code) - jumpWidth
+}
+
+// emitJumpTo emits a jump instruction to a known offset.
+func (c *Compiler) emitJumpTo(op opcode, target int, loc location.Location) error {
+	return c.writeJump(c.emitJump(op, loc), target, loc)
+}
+
+// patchJump points a previously emitted jump to the current offset.
+func (c *Compiler) patchJump(operand int, loc location.Location) error {
+	return c.writeJump(operand, len(c.fn.code.Code), loc)
+}
+
+// writeJump writes a jump target into the operand position.
+func (c *Compiler) writeJump(operand int, target int, loc location.Location) error {
+	if target > maxOperand(jumpWidth) {
+		return c.error(fmt.Sprintf("jump target out of range: %d (limit %d)", target, maxOperand(jumpWidth)), loc)
+	}
+
+	copy(c.fn.code.Code[operand:], encodeOperand(target, jumpWidth))
+
+	return nil
+}
+
+// addConstant adds a number or string constant, reusing an equal one, and returns its index.
+func (c *Compiler) addConstant(value runtime.Value) int {
+	key := constantKey{kind: value.Type()}
+
+	switch value.Type() {
+	case runtime.NumberType:
+		key.bits = math.Float64bits(value.(runtime.Number).Value)
+	case runtime.StringType:
+		key.str = value.(runtime.String).Value
+	}
+
+	if idx, ok := c.fn.constants[key]; ok {
+		return idx
+	}
+
+	c.fn.code.Constants = append(c.fn.code.Constants, value)
+	c.fn.constants[key] = len(c.fn.code.Constants) - 1
+
+	return len(c.fn.code.Constants) - 1
+}
+
+// bind binds a variable to a new frame slot in the current scope and returns the slot.
+func (fn *function) bind(name string) int {
+	slot := len(fn.code.Locals)
+
+	fn.code.Locals = append(fn.code.Locals, name)
+	fn.locals = append(fn.locals, local{name: name, depth: fn.depth, slot: slot})
+
+	return slot
+}
+
+// reserve binds a variable of the current scope that is declared later, visible only to the nested functions.
+func (fn *function) reserve(name string) {
+	if _, ok := fn.lookup(name); !ok {
+		fn.bind(name)
+		fn.locals[len(fn.locals)-1].pending = true
+	}
+}
+
+// declare returns the slot of a variable of the current scope, binding a new one if it is not declared yet.
+// A redeclaration shares the slot so the virtual machine reports it as already defined.
+func (fn *function) declare(name string) int {
+	if idx, ok := fn.lookup(name); ok {
+		fn.locals[idx].pending = false
+
+		return fn.locals[idx].slot
+	}
+
+	return fn.bind(name)
+}
+
+// lookup finds a variable of the current scope.
+func (fn *function) lookup(name string) (int, bool) {
+	for idx := len(fn.locals) - 1; idx >= 0 && fn.locals[idx].depth == fn.depth; idx-- {
+		if fn.locals[idx].name == name {
+			return idx, true
+		}
+	}
+
+	return 0, false
+}
+
+// resolveLocal finds the slot of a variable in scope of the function, including the pending ones if requested.
+func (fn *function) resolveLocal(name string, pending bool) (int, bool) {
+	for idx := len(fn.locals) - 1; idx >= 0; idx-- {
+		if fn.locals[idx].name == name && (pending || !fn.locals[idx].pending) {
+			return fn.locals[idx].slot, true
+		}
+	}
+
+	return 0, false
+}
+
+// resolveUpvalue finds a variable of an enclosing function, capturing it through every function in between.
+func (fn *function) resolveUpvalue(name string) (int, bool) {
+	if fn.enclosing == nil {
+		return 0, false
+	}
+
+	// a function can be called once the pending variables of its enclosing scopes are defined
+	if slot, ok := fn.enclosing.resolveLocal(name, true); ok {
+		return fn.capture(Capture{Name: name, Local: true, Index: slot}), true
+	}
+
+	if idx, ok := fn.enclosing.resolveUpvalue(name); ok {
+		return fn.capture(Capture{Name: name, Local: false, Index: idx}), true
+	}
+
+	return 0, false
+}
+
+// capture adds a captured variable, reusing an equal one, and returns its index.
+func (fn *function) capture(capture Capture) int {
+	for idx, upvalue := range fn.code.Upvalues {
+		if upvalue == capture {
+			return idx
+		}
+	}
+
+	fn.code.Upvalues = append(fn.code.Upvalues, capture)
+
+	return len(fn.code.Upvalues) - 1
+}
+
+// error makes an error.
+func (c *Compiler) error(msg string, loc location.Location) *debug.Error {
+	return &debug.Error{
+		Msg:      msg,
+		Line:     loc.End.Line,
+		Column:   loc.End.Column,
+		File:     loc.File,
+		Location: loc,
+	}
 }
@@ -0,0 +1,130 @@
+package vm
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/danielspk/tatu-lang/pkg/location"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+// Instruction represents a decoded bytecode instruction.
+type Instruction struct {
+	Offset   int
+	Opcode   opcode
+	Operands []int
+	Location location.Location
+}
+
+// Disassemble decodes the code into its list of instructions.
+func Disassemble(code *Code) ([]Instruction, error) {
+	instructions := make([]Instruction, 0)
+	offset := 0
+
+	for offset < len(code.Code) {
+		ins, err := decode(code, offset)
+		if err != nil {
+			return nil, fmt.Errorf("%w at offset %d", err, offset)
+		}
+
+		instructions = append(instructions, ins)
+		offset = ins.next()
+	}
+
+	return instructions, nil
+}
+
+// decode decodes the instruction at an offset.
+func decode(code *Code, offset int) (Instruction, error) {
+	op := opcode(code.Code[offset])
+
+	def, ok := definitions[op]
+	if !ok {
+		return Instruction{}, fmt.Errorf("unknown opcode 0x%02X", byte(op))
+	}
+
+	ins := Instruction{
+		Offset:   offset,
+		Opcode:   op,
+		Operands: make([]int, 0, len(def.operands)),
+	}
+
+	ins.Location, _ = code.LocationAt(offset)
+
+	offset++
+
+	for _, width := range def.operands {
+		if offset+width > len(code.Code) {
+			return Instruction{}, fmt.Errorf("truncated operand of %s", op)
+		}
+
+		ins.Operands = append(ins.Operands, readOperand(code.Code[offset:], width))
+		offset += width
+	}
+
+	return ins, nil
+}
+
+// next returns the offset of the following instruction.
+func (ins Instruction) next() int {
+	next := ins.Offset + 1
+
+	for _, width := range definitions[ins.Opcode].operands {
+		next += width
+	}
+
+	return next
+}
+
+// Describe returns the resolved meaning of the instruction operands: a constant, a function, a variable or a jump target.
+func (ins Instruction) Describe(code *Code) string {
+	if len(ins.Operands) == 0 {
+		return ""
+	}
+
+	operand := ins.Operands[0]
+
+	switch definitions[ins.Opcode].kind {
+	case operandConstant:
+		if operand >= len(code.Constants) {
+			return "<invalid constant>"
+		}
+
+		constant := code.Constants[operand]
+		if constant.Type() == runtime.StringType {
+			return strconv.Quote(constant.String())
+		}
+
+		return constant.String()
+
+	case operandFunction:
+		if operand >= len(code.Functions) {
+			return "<invalid function>"
+		}
+
+		return fmt.Sprintf("<fn %s>", code.Functions[operand].Name)
+
+	case operandJump:
+		return fmt.Sprintf("-> %04d", operand)
+
+	case operandLocal:
+		if operand >= len(code.Locals) {
+			return "<invalid local>"
+		}
+
+		return code.Locals[operand]
+
+	case operandUpvalue:
+		if operand >= len(code.Upvalues) {
+			return "<invalid upvalue>"
+		}
+
+		return code.Upvalues[operand].Name
+
+	case operandScope:
+		return fmt.Sprintf("slots %d..%d", operand, operand+ins.Operands[1]-1)
+
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,408 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/danielspk/tatu-lang/pkg/location"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+// FormatVersion is the version of the serialized bytecode format.
+const FormatVersion = 1
+
+// formatMagic identifies a serialized bytecode file.
+var formatMagic = []byte("TATUC")
+
+// Constant pool entry tags.
+const (
+	constantNumber byte = 0x01
+	constantString byte = 0x02
+)
+
+// Source identifies a source file of a compiled program.
+type Source struct {
+	File string
+	Hash [sha256.Size]byte
+}
+
+// Matches checks if the content is the one the program was compiled from.
+func (s Source) Matches(content []byte) bool {
+	return sha256.Sum256(content) == s.Hash
+}
+
+// Program represents a compiled program: the code of each top-level expression and the source files it comes from.
+type Program struct {
+	Sources []Source
+	Codes   []*Code
+}
+
+// NewProgram builds a new Program hashing the contents of its source files.
+func NewProgram(codes []*Code, sources map[string][]byte) *Program {
+	program := &Program{
+		Sources: make([]Source, 0, len(sources)),
+		Codes:   codes,
+	}
+
+	for file, content := range sources {
+		program.Sources = append(program.Sources, Source{File: file, Hash: sha256.Sum256(content)})
+	}
+
+	sort.Slice(program.Sources, func(i, j int) bool {
+		return program.Sources[i].File < program.Sources[j].File
+	})
+
+	return program
+}
+
+// Marshal serializes a compiled program.
+//
+// Layout (integers are unsigned varints):
+//
+//	magic "TATUC", version
+//	sources: count, then file and SHA-256 hash of each one
+//	codes: count, then each code unit
+//
+// A code unit holds its name, params, locals, upvalues, typed constant pool, bytecode,
+// line table (file as an index into the sources) and nested functions.
+func Marshal(program *Program) ([]byte, error) {
+	enc := &encoder{files: make(map[string]int)}
+	sources := append([]Source(nil), program.Sources...)
+
+	for idx, source := range sources {
+		enc.files[source.File] = idx
+	}
+
+	// locations of files without a known source (e.g. synthetic ones) are kept with an empty hash
+	var collect func(code *Code)
+	collect = func(code *Code) {
+		for _, line := range code.Lines {
+			if _, ok := enc.files[line.Location.File]; !ok {
+				enc.files[line.Location.File] = len(sources)
+				sources = append(sources, Source{File: line.Location.File})
+			}
+		}
+
+		for _, fn := range code.Functions {
+			collect(fn)
+		}
+	}
+
+	for _, code := range program.Codes {
+		collect(code)
+	}
+
+	enc.buf.Write(formatMagic)
+	enc.uint(FormatVersion)
+
+	enc.uint(len(sources))
+
+	for _, source := range sources {
+		enc.string(source.File)
+		enc.buf.Write(source.Hash[:])
+	}
+
+	enc.uint(len(program.Codes))
+
+	for _, code := range program.Codes {
+		if err := enc.code(code); err != nil {
+			return nil, err
+		}
+	}
+
+	return enc.buf.Bytes(), nil
+}
+
+// Unmarshal deserializes a compiled program, verifying its code before it can be executed.
+func Unmarshal(data []byte) (*Program, error) {
+	if !bytes.HasPrefix(data, formatMagic) {
+		return nil, errors.New("invalid bytecode file: missing `TATUC` header")
+	}
+
+	dec := &decoder{data: data[len(formatMagic):]}
+
+	if version := dec.uint(); dec.err == nil && version != FormatVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d: expected %d", version, FormatVersion)
+	}
+
+	program := &Program{}
+
+	count := dec.count(1 + sha256.Size)
+	program.Sources = make([]Source, 0, count)
+
+	for range count {
+		source := Source{File: dec.string()}
+		copy(source.Hash[:], dec.bytes(sha256.Size))
+
+		program.Sources = append(program.Sources, source)
+	}
+
+	dec.files = program.Sources
+
+	count = dec.count(1)
+	program.Codes = make([]*Code, 0, count)
+
+	for range count {
+		program.Codes = append(program.Codes, dec.code())
+	}
+
+	if dec.err == nil && len(dec.data) > 0 {
+		dec.fail("%d trailing bytes", len(dec.data))
+	}
+
+	if dec.err != nil {
+		return nil, fmt.Errorf("invalid bytecode file: %w", dec.err)
+	}
+
+	for _, code := range program.Codes {
+		if err := Verify(code); err != nil {
+			return nil, err
+		}
+	}
+
+	return program, nil
+}
+
+// encoder writes the serialized format.
+type encoder struct {
+	buf   bytes.Buffer
+	files map[string]int
+}
+
+// code writes a code unit and its nested functions.
+func (enc *encoder) code(code *Code) error {
+	enc.string(code.Name)
+	enc.strings(code.Params)
+	enc.strings(code.Locals)
+
+	enc.uint(len(code.Upvalues))
+
+	for _, upvalue := range code.Upvalues {
+		enc.string(upvalue.Name)
+		enc.bool(upvalue.Local)
+		enc.uint(upvalue.Index)
+	}
+
+	enc.uint(len(code.Constants))
+
+	for idx, constant := range code.Constants {
+		switch value := constant.(type) {
+		case runtime.Number:
+			enc.buf.WriteByte(constantNumber)
+			enc.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(value.Value)))
+		case runtime.String:
+			enc.buf.WriteByte(constantString)
+			enc.string(value.Value)
+		default:
+			return fmt.Errorf("cannot serialize constant %d of `%s`: unsupported type %s", idx, code.Name, constant.Type())
+		}
+	}
+
+	enc.uint(len(code.Code))
+	enc.buf.Write(code.Code)
+
+	enc.uint(len(code.Lines))
+
+	for _, line := range code.Lines {
+		enc.uint(line.Offset)
+		enc.uint(enc.files[line.Location.File])
+		enc.position(line.Location.Start)
+		enc.position(line.Location.End)
+	}
+
+	enc.uint(len(code.Functions))
+
+	for _, fn := range code.Functions {
+		if err := enc.code(fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// position writes a source position.
+func (enc *encoder) position(pos location.Position) {
+	enc.uint(int(pos.Line))
+	enc.uint(int(pos.Column))
+	enc.uint(int(pos.Offset))
+}
+
+// strings writes a list of strings.
+func (enc *encoder) strings(values []string) {
+	enc.uint(len(values))
+
+	for _, value := range values {
+		enc.string(value)
+	}
+}
+
+// string writes a length-prefixed string.
+func (enc *encoder) string(value string) {
+	enc.uint(len(value))
+	enc.buf.WriteString(value)
+}
+
+// bool writes a boolean as a byte.
+func (enc *encoder) bool(value bool) {
+	if value {
+		enc.buf.WriteByte(1)
+	} else {
+		enc.buf.WriteByte(0)
+	}
+}
+
+// uint writes an unsigned varint.
+func (enc *encoder) uint(value int) {
+	enc.buf.Write(binary.AppendUvarint(nil, uint64(value)))
+}
+
+// decoder reads the serialized format. The first failure is kept and later reads return zero values.
+type decoder struct {
+	data  []byte
+	files []Source
+	err   error
+}
+
+// code reads a code unit and its nested functions.
+func (dec *decoder) code() *Code {
+	code := NewCode(dec.string())
+	code.Params = dec.strings()
+	code.Locals = dec.strings()
+
+	for range dec.count(3) {
+		code.Upvalues = append(code.Upvalues, Capture{Name: dec.string(), Local: dec.bool(), Index: dec.uint()})
+	}
+
+	for range dec.count(2) {
+		switch tag := dec.byte(); tag {
+		case constantNumber:
+			bits := dec.bytes(8)
+			if dec.err == nil {
+				code.Constants = append(code.Constants, runtime.NewNumber(math.Float64frombits(binary.BigEndian.Uint64(bits))))
+			}
+		case constantString:
+			code.Constants = append(code.Constants, runtime.NewString(dec.string()))
+		default:
+			dec.fail("unknown constant tag 0x%02X in `%s`", tag, code.Name)
+		}
+	}
+
+	code.Code = append(code.Code, dec.bytes(dec.count(1))...)
+
+	for range dec.count(8) {
+		line := Line{Offset: dec.uint()}
+
+		if file := dec.uint(); file < len(dec.files) {
+			line.Location.File = dec.files[file].File
+		} else {
+			dec.fail("unknown source file %d in `%s`", file, code.Name)
+		}
+
+		line.Location.Start = dec.position()
+		line.Location.End = dec.position()
+
+		code.Lines = append(code.Lines, line)
+	}
+
+	for range dec.count(1) {
+		code.Functions = append(code.Functions, dec.code())
+	}
+
+	return code
+}
+
+// position reads a source position.
+func (dec *decoder) position() location.Position {
+	return location.NewPosition(uint(dec.uint()), uint(dec.uint()), uint(dec.uint()))
+}
+
+// strings reads a list of strings.
+func (dec *decoder) strings() []string {
+	count := dec.count(1)
+	values := make([]string, 0, count)
+
+	for range count {
+		values = append(values, dec.string())
+	}
+
+	return values
+}
+
+// string reads a length-prefixed string.
+func (dec *decoder) string() string {
+	return string(dec.bytes(dec.count(1)))
+}
+
+// bool reads a boolean byte.
+func (dec *decoder) bool() bool {
+	return dec.byte() == 1
+}
+
+// byte reads a single byte.
+func (dec *decoder) byte() byte {
+	if b := dec.bytes(1); len(b) == 1 {
+		return b[0]
+	}
+
+	return 0
+}
+
+// bytes reads n raw bytes.
+func (dec *decoder) bytes(n int) []byte {
+	if dec.err != nil {
+		return nil
+	}
+
+	if n > len(dec.data) {
+		dec.fail("unexpected end of data")
+		return nil
+	}
+
+	b := dec.data[:n]
+	dec.data = dec.data[n:]
+
+	return b
+}
+
+// count reads the number of entries of a list whose entries take at least size bytes each,
+// so a corrupted count cannot allocate more than the remaining data.
+func (dec *decoder) count(size int) int {
+	n := dec.uint()
+
+	if n > len(dec.data)/size {
+		dec.fail("count %d exceeds the remaining data", n)
+		return 0
+	}
+
+	return n
+}
+
+// uint reads an unsigned varint.
+func (dec *decoder) uint() int {
+	if dec.err != nil {
+		return 0
+	}
+
+	value, n := binary.Uvarint(dec.data)
+	if n <= 0 || value > math.MaxInt32 {
+		dec.fail("invalid integer")
+		return 0
+	}
+
+	dec.data = dec.data[n:]
+
+	return int(value)
+}
+
+// fail keeps the first decoding failure.
+func (dec *decoder) fail(format string, args ...any) {
+	if dec.err == nil {
+		dec.err = fmt.Errorf(format, args...)
+	}
+}
@@ -0,0 +1,124 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const formatSource = `(def add (a b) (+ a b))
+(add 1 "two")`
+
+// marshalSource compiles a source and serializes it with the source file first.
+func marshalSource(t *testing.T) ([]byte, *Code) {
+	t.Helper()
+
+	code := compileSource(t, formatSource)
+
+	data, err := Marshal(NewProgram([]*Code{code}, map[string][]byte{"test.tatu": []byte(formatSource)}))
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %v", err)
+	}
+
+	return data, code
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	valid, code := marshalSource(t)
+
+	// offset of the version and of the count of source files, right after the magic
+	version := len(formatMagic)
+	sources := version + 1
+
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+		err     string
+	}{
+		{
+			name:    "bad magic",
+			corrupt: func(data []byte) []byte { data[0] = 'X'; return data },
+			err:     "missing `TATUC` header",
+		},
+		{
+			name:    "wrong version",
+			corrupt: func(data []byte) []byte { data[version] = FormatVersion + 1; return data },
+			err:     "unsupported bytecode version 2: expected 1",
+		},
+		{
+			name:    "invalid integer",
+			corrupt: func(data []byte) []byte { return append(data[:version], bytes.Repeat([]byte{0xFF}, 10)...) },
+			err:     "invalid integer",
+		},
+		{
+			name:    "oversized count",
+			corrupt: func(data []byte) []byte { data[sources] = 0x7F; return data },
+			err:     "count 127 exceeds the remaining data",
+		},
+		{
+			name: "invalid instruction",
+			corrupt: func(data []byte) []byte {
+				data[bytes.Index(data, code.Code)] = 0xFF
+				return data
+			},
+			err: "unknown opcode 0xFF",
+		},
+		{
+			name:    "truncated",
+			corrupt: func(data []byte) []byte { return data[:len(data)-1] },
+			err:     "invalid bytecode file",
+		},
+		{
+			name:    "trailing bytes",
+			corrupt: func(data []byte) []byte { return append(data, 0x00, 0x00) },
+			err:     "2 trailing bytes",
+		},
+		{
+			name:    "empty",
+			corrupt: func(data []byte) []byte { return nil },
+			err:     "missing `TATUC` header",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Unmarshal(test.corrupt(bytes.Clone(valid)))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error containing %q, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+// Every truncation of a valid file is rejected without panicking.
+func TestUnmarshalTruncated(t *testing.T) {
+	valid, _ := marshalSource(t)
+
+	if _, err := Unmarshal(valid); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+
+	for size := range len(valid) {
+		if _, err := Unmarshal(valid[:size]); err == nil {
+			t.Fatalf("expected an error for the first %d of %d bytes", size, len(valid))
+		}
+	}
+}
+
+// A changed source hash does not invalidate the bytecode, the source is no longer used to report errors.
+func TestUnmarshalSourceHashMismatch(t *testing.T) {
+	data, _ := marshalSource(t)
+
+	// magic, version, count of sources, length and name of the first file
+	hash := len(formatMagic) + 3 + len("test.tatu")
+	data[hash] ^= 0xFF
+
+	program, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+
+	if source := program.Sources[0]; source.File != "test.tatu" || source.Matches([]byte(formatSource)) {
+		t.Errorf("expected the hash of `test.tatu` not to match its content, got %+v", source)
+	}
+}
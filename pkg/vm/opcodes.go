@@ -1,5 +1,7 @@
 package vm
 
+import "fmt"
+
 // opcode ...
 type opcode byte
 
@@ -7,8 +9,116 @@ type opcode byte
 const (
 	OpHalt  opcode = 0x00 // stops the program
 	OpConst opcode = 0x01 // pushes a const onto the stack
-	OpAdd   opcode = 0x02 // addition instruction
-	OpSub   opcode = 0x03 // substraction instruction
-	OpMul   opcode = 0x04 // multiplication instruction
-	OpDiv   opcode = 0x05 // division instruction
+
+	// 0x02 to 0x05 are unused: arithmetic compiles to calls of the `+`, `-`, `*` and `/` natives
+
+	OpNil   opcode = 0x06 // pushes nil onto the stack
+	OpTrue  opcode = 0x07 // pushes true onto the stack
+	OpFalse opcode = 0x08 // pushes false onto the stack
+	OpPop   opcode = 0x09 // discards the top of the stack
+
+	OpGetGlobal    opcode = 0x0A // pushes the value of a global or native binding
+	OpDefineGlobal opcode = 0x0B // defines a global binding with the top of the stack
+	OpSetGlobal    opcode = 0x0C // assigns the top of the stack to a global binding
+
+	OpGetLocal    opcode = 0x0D // pushes the value of a frame slot
+	OpDefineLocal opcode = 0x0E // defines a frame slot with the top of the stack
+	OpSetLocal    opcode = 0x0F // assigns the top of the stack to a frame slot
+	OpGetUpvalue  opcode = 0x10 // pushes the value of a captured variable
+	OpSetUpvalue  opcode = 0x11 // assigns the top of the stack to a captured variable
+	OpExitScope   opcode = 0x12 // undefines the frame slots of a closing lexical scope
+
+	OpJump        opcode = 0x13 // jumps unconditionally to an offset
+	OpJumpIfFalse opcode = 0x14 // pops a BOOL and jumps to an offset when it is false
+	OpAnd         opcode = 0x15 // pops a BOOL and short-circuits `and` to an offset when it is false
+	OpOr          opcode = 0x16 // pops a BOOL and short-circuits `or` to an offset when it is true
+
+	OpVector opcode = 0x17 // builds a vector from the top N values of the stack
+	OpMap    opcode = 0x18 // builds a map from the top N key-value pairs of the stack
+
+	OpClosure opcode = 0x19 // pushes a function capturing the variables of the current frame
+	OpCall    opcode = 0x1A // calls a function with the top N values of the stack as arguments
+	OpRecur   opcode = 0x1B // restarts the current function with the top N values of the stack as arguments
+	OpReturn  opcode = 0x1C // returns the top of the stack from the current function
+
+	OpConstLong opcode = 0x1D // pushes a const with a wide index onto the stack
+
+	OpDefineLocalPop opcode = 0x1E // fused DEFINE_LOCAL and POP emitted by the optimizer
+	OpSetLocalPop    opcode = 0x1F // fused SET_LOCAL and POP emitted by the optimizer
 )
+
+// Operand widths (in bytes).
+const (
+	constWidth     = 1 // constant index of OpConst
+	constLongWidth = 3 // constant index of OpConstLong
+	nameWidth      = 2 // constant index holding the name of a binding
+	localWidth     = 2 // frame slot index
+	upvalueWidth   = 2 // captured variable index
+	jumpWidth      = 4 // absolute offset into the code
+	functionWidth  = 2 // nested function index
+	countWidth     = 2 // number of elements of a vector or map
+	argsWidth      = 2 // number of arguments of a call
+)
+
+// operandKind describes how the operand of an instruction is interpreted.
+type operandKind uint8
+
+// Operand kinds.
+const (
+	operandNone     operandKind = iota // no operands
+	operandConstant                    // index into the constant pool
+	operandFunction                    // index into the nested functions
+	operandJump                        // absolute offset into the code
+	operandCount                       // number of values taken from the stack
+	operandLocal                       // index into the frame slots
+	operandUpvalue                     // index into the captured variables
+	operandScope                       // first frame slot and number of slots of a scope
+)
+
+// definition describes the mnemonic and the operand widths (in bytes) of an opcode.
+type definition struct {
+	name     string
+	kind     operandKind
+	operands []int
+}
+
+// definitions indexes every opcode definition.
+var definitions = map[opcode]definition{
+	OpHalt:           {"HALT", operandNone, nil},
+	OpConst:          {"CONST", operandConstant, []int{constWidth}},
+	OpConstLong:      {"CONST_LONG", operandConstant, []int{constLongWidth}},
+	OpNil:            {"NIL", operandNone, nil},
+	OpTrue:           {"TRUE", operandNone, nil},
+	OpFalse:          {"FALSE", operandNone, nil},
+	OpPop:            {"POP", operandNone, nil},
+	OpGetGlobal:      {"GET_GLOBAL", operandConstant, []int{nameWidth}},
+	OpDefineGlobal:   {"DEFINE_GLOBAL", operandConstant, []int{nameWidth}},
+	OpSetGlobal:      {"SET_GLOBAL", operandConstant, []int{nameWidth}},
+	OpGetLocal:       {"GET_LOCAL", operandLocal, []int{localWidth}},
+	OpDefineLocal:    {"DEFINE_LOCAL", operandLocal, []int{localWidth}},
+	OpSetLocal:       {"SET_LOCAL", operandLocal, []int{localWidth}},
+	OpDefineLocalPop: {"DEFINE_LOCAL_POP", operandLocal, []int{localWidth}},
+	OpSetLocalPop:    {"SET_LOCAL_POP", operandLocal, []int{localWidth}},
+	OpGetUpvalue:     {"GET_UPVALUE", operandUpvalue, []int{upvalueWidth}},
+	OpSetUpvalue:     {"SET_UPVALUE", operandUpvalue, []int{upvalueWidth}},
+	OpExitScope:      {"EXIT_SCOPE", operandScope, []int{localWidth, localWidth}},
+	OpJump:           {"JUMP", operandJump, []int{jumpWidth}},
+	OpJumpIfFalse:    {"JUMP_IF_FALSE", operandJump, []int{jumpWidth}},
+	OpAnd:            {"AND", operandJump, []int{jumpWidth}},
+	OpOr:             {"OR", operandJump, []int{jumpWidth}},
+	OpVector:         {"VECTOR", operandCount, []int{countWidth}},
+	OpMap:            {"MAP", operandCount, []int{countWidth}},
+	OpClosure:        {"CLOSURE", operandFunction, []int{functionWidth}},
+	OpCall:           {"CALL", operandCount, []int{argsWidth}},
+	OpRecur:          {"RECUR", operandCount, []int{argsWidth}},
+	OpReturn:         {"RETURN", operandNone, nil},
+}
+
+// String returns the mnemonic of the opcode.
+func (op opcode) String() string {
+	if def, ok := definitions[op]; ok {
+		return def.name
+	}
+
+	return fmt.Sprintf("UNKNOWN(0x%02X)", byte(op))
+}
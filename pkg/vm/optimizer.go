@@ -0,0 +1,202 @@
+package vm
+
+import (
+	"github.com/danielspk/tatu-lang/pkg/ast"
+	"github.com/danielspk/tatu-lang/pkg/core/builtins"
+	"github.com/danielspk/tatu-lang/pkg/location"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+// foldable holds the pure natives the optimizer evaluates at compile time.
+var foldable = func() *runtime.Environment {
+	env := runtime.NewEnvironment(nil, nil)
+
+	builtins.RegisterArithmetic(env)
+	builtins.RegisterComparison(env)
+
+	return env
+}()
+
+// fold evaluates an expression at compile time when it only applies pure natives to literals, e.g. `(+ 1 2)`.
+// Calls that fail or build a string are left for the virtual machine, so the error is reported and the
+// allocation is accounted at run time.
+func (c *Compiler) fold(expr ast.SExpr) (runtime.Value, bool) {
+	switch e := expr.(type) {
+	case *ast.NumberExpr:
+		return runtime.NewNumber(e.Number), true
+	case *ast.StringExpr:
+		return runtime.NewString(e.String), true
+	case *ast.BoolExpr:
+		return runtime.NewBool(e.Bool), true
+	case *ast.NilExpr:
+		return runtime.NewNil(), true
+	case *ast.ListExpr:
+		if len(e.List) == 0 {
+			return runtime.NewNil(), true
+		}
+
+		head, ok := e.List[0].(*ast.SymbolExpr)
+		if !ok || c.isVariable(head.Symbol) || c.globals[head.Symbol] || !c.natives.IsNative(head.Symbol) {
+			return nil, false
+		}
+
+		native, ok := foldable.Lookup(head.Symbol)
+		if !ok {
+			return nil, false
+		}
+
+		args := make([]runtime.Value, 0, len(e.List)-1)
+
+		for _, arg := range e.List[1:] {
+			value, ok := c.fold(arg)
+			if !ok {
+				return nil, false
+			}
+
+			args = append(args, value)
+		}
+
+		result, err := native.(runtime.NativeFunction).Value(args...)
+		if err != nil {
+			return nil, false
+		}
+
+		switch result.Type() {
+		case runtime.NumberType, runtime.BoolType, runtime.NilType:
+			return result, true
+		}
+	}
+
+	return nil, false
+}
+
+// isVariable checks if a name is bound to a variable of the current or an enclosing function.
+func (c *Compiler) isVariable(name string) bool {
+	for fn := c.fn; fn != nil; fn = fn.enclosing {
+		if _, ok := fn.resolveLocal(name, true); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// emitValue emits an instruction that pushes a folded value.
+func (c *Compiler) emitValue(value runtime.Value, loc location.Location) error {
+	switch value.Type() {
+	case runtime.BoolType:
+		if value.(runtime.Bool).Value {
+			c.emit(loc, OpTrue)
+		} else {
+			c.emit(loc, OpFalse)
+		}
+
+		return nil
+
+	case runtime.NilType:
+		c.emit(loc, OpNil)
+		return nil
+
+	default:
+		return c.emitConstant(value, loc)
+	}
+}
+
+// optimize rewrites the code of a unit and its nested functions with peephole optimizations:
+//   - a constant pushed and popped right away is removed,
+//   - DEFINE_LOCAL or SET_LOCAL followed by POP is fused into a single instruction,
+//   - jumps to an unconditional jump go straight to its target.
+//
+// Instructions keep their source locations and jump targets are remapped to the new offsets.
+func optimize(code *Code) {
+	for _, fn := range code.Functions {
+		optimize(fn)
+	}
+
+	instructions, err := Disassemble(code)
+	if err != nil {
+		return
+	}
+
+	targets := make(map[int]bool)
+	byOffset := make(map[int]Instruction, len(instructions))
+
+	for _, ins := range instructions {
+		byOffset[ins.Offset] = ins
+
+		if definitions[ins.Opcode].kind == operandJump {
+			targets[ins.Operands[0]] = true
+		}
+	}
+
+	optimized := make([]Instruction, 0, len(instructions))
+	offsets := make(map[int]int, len(instructions)) // old offset -> index of the instruction that replaces it
+
+	for idx := 0; idx < len(instructions); idx++ {
+		ins := instructions[idx]
+		offsets[ins.Offset] = len(optimized)
+
+		if idx+1 < len(instructions) && instructions[idx+1].Opcode == OpPop && !targets[instructions[idx+1].Offset] {
+			switch ins.Opcode {
+			case OpConst, OpConstLong, OpNil, OpTrue, OpFalse:
+				offsets[instructions[idx+1].Offset] = len(optimized)
+				idx++
+
+				continue
+
+			case OpDefineLocal, OpSetLocal:
+				fused := OpDefineLocalPop
+				if ins.Opcode == OpSetLocal {
+					fused = OpSetLocalPop
+				}
+
+				offsets[instructions[idx+1].Offset] = len(optimized)
+				optimized = append(optimized, Instruction{Offset: ins.Offset, Opcode: fused, Operands: ins.Operands, Location: ins.Location})
+				idx++
+
+				continue
+			}
+		}
+
+		if definitions[ins.Opcode].kind == operandJump {
+			// bounded, so jumps forming a cycle do not hang the compiler
+			for hops := 0; hops < len(instructions); hops++ {
+				target, ok := byOffset[ins.Operands[0]]
+				if !ok || target.Opcode != OpJump || target.Operands[0] == ins.Operands[0] {
+					break
+				}
+
+				ins.Operands = []int{target.Operands[0]}
+			}
+		}
+
+		optimized = append(optimized, ins)
+	}
+
+	// new offsets of every instruction, plus the end of the code
+	starts := make([]int, len(optimized)+1)
+
+	for idx, ins := range optimized {
+		starts[idx+1] = starts[idx] + ins.next() - ins.Offset
+	}
+
+	offsets[len(code.Code)] = len(optimized)
+
+	code.Code = make([]byte, 0, starts[len(optimized)])
+	code.Lines = make([]Line, 0, len(code.Lines))
+
+	for _, ins := range optimized {
+		code.addLine(len(code.Code), ins.Location)
+		code.Code = append(code.Code, byte(ins.Opcode))
+
+		for idx, width := range definitions[ins.Opcode].operands {
+			operand := ins.Operands[idx]
+
+			if definitions[ins.Opcode].kind == operandJump {
+				operand = starts[offsets[operand]]
+			}
+
+			code.Code = append(code.Code, encodeOperand(operand, width)...)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package vm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/builder"
+	"github.com/danielspk/tatu-lang/pkg/core/builtins"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+// compileSource compiles a source with the given compiler options.
+func compileSource(t *testing.T, source string, opts ...CompilerOption) *Code {
+	t.Helper()
+
+	_, program, err := builder.NewProgramBuilderWithDefaults().BuildFromSource([]byte(source), "test.tatu")
+	if err != nil {
+		t.Fatalf("unexpected build error: %v", err)
+	}
+
+	compiler := NewCompiler(opts...)
+
+	code, err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+
+	return code
+}
+
+// listing returns the instructions of a code unit as `OFFSET MNEMONIC DESCRIPTION` lines.
+func listing(t *testing.T, code *Code) []string {
+	t.Helper()
+
+	instructions, err := Disassemble(code)
+	if err != nil {
+		t.Fatalf("unexpected disassemble error: %v", err)
+	}
+
+	lines := make([]string, 0, len(instructions))
+
+	for _, ins := range instructions {
+		lines = append(lines, strings.TrimSpace(fmt.Sprintf("%04d %s %s", ins.Offset, ins.Opcode, ins.Describe(code))))
+	}
+
+	return lines
+}
+
+func TestOptimizer(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		modules []runtime.Module
+		expect  []string
+	}{
+		{
+			name:   "constant folding",
+			source: `(+ 1 (* 2 3))`,
+			expect: []string{"0000 CONST 7", "0002 HALT"},
+		},
+		{
+			name:   "folded condition",
+			source: `(if (< 1 2) "yes" "no")`,
+			expect: []string{`0000 CONST "yes"`, "0002 HALT"},
+		},
+		{
+			name:    "natives not registered",
+			source:  `(+ 1 2)`,
+			modules: []runtime.Module{builtins.RegisterComparison},
+			expect:  []string{`0000 GET_GLOBAL "+"`, "0003 CONST 1", "0005 CONST 2", "0007 CALL", "0010 HALT"},
+		},
+		{
+			name:    "global defined by the program",
+			source:  "(var + 0)\n(+ 1 2)",
+			modules: []runtime.Module{builtins.RegisterComparison},
+			expect: []string{
+				"0000 CONST 0", `0002 DEFINE_GLOBAL "+"`, "0005 POP", `0006 GET_GLOBAL "+"`,
+				"0009 CONST 1", "0011 CONST 2", "0013 CALL", "0016 HALT",
+			},
+		},
+		{
+			name:   "string not folded",
+			source: `(+ "a" "b")`,
+			expect: []string{`0000 GET_GLOBAL "+"`, `0003 CONST "a"`, `0005 CONST "b"`, "0007 CALL", "0010 HALT"},
+		},
+		{
+			name:   "constant and pop removal",
+			source: `(block 1 nil 2)`,
+			expect: []string{"0000 CONST 2", "0002 HALT"},
+		},
+		{
+			name:   "define and set fusion",
+			source: `(block (var x 1) (set x 2) x)`,
+			expect: []string{
+				"0000 CONST 1", "0002 DEFINE_LOCAL_POP x", "0005 CONST 2", "0007 SET_LOCAL_POP x",
+				"0010 GET_LOCAL x", "0013 EXIT_SCOPE slots 0..0", "0018 HALT",
+			},
+		},
+		{
+			// the jump out of the inner `if` goes straight to the end of the outer one
+			name:   "jump threading",
+			source: `(if a (if b 1 2) 3)`,
+			expect: []string{
+				`0000 GET_GLOBAL "a"`, "0003 JUMP_IF_FALSE -> 0030", `0008 GET_GLOBAL "b"`, "0011 JUMP_IF_FALSE -> 0023",
+				"0016 CONST 1", "0018 JUMP -> 0032", "0023 CONST 2", "0025 JUMP -> 0032", "0030 CONST 3", "0032 HALT",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code := compileSource(t, test.source, WithOptimizations(test.modules...))
+
+			if got := listing(t, code); !slices.Equal(got, test.expect) {
+				t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(test.expect, "\n"), strings.Join(got, "\n"))
+			}
+
+			if err := Verify(code); err != nil {
+				t.Errorf("unexpected verify error: %v", err)
+			}
+		})
+	}
+}
+
+// Shadowed natives are not folded.
+func TestOptimizerShadowedNative(t *testing.T) {
+	code := compileSource(t, `(def f (not x) (not true))`, WithOptimizations())
+
+	got := listing(t, code.Functions[0])
+	expect := []string{"0000 GET_LOCAL not", "0003 TRUE", "0004 CALL", "0007 RETURN"}
+
+	if !slices.Equal(got, expect) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expect, "\n"), strings.Join(got, "\n"))
+	}
+}
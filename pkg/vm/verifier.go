@@ -0,0 +1,234 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+// VerifyError describes an instruction rejected by the verifier.
+type VerifyError struct {
+	Function string // path of the code unit, e.g. `main/fact`
+	Offset   int
+	Msg      string
+}
+
+// Error returns the error message.
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("invalid bytecode in `%s` at offset %04d: %s", e.Function, e.Offset, e.Msg)
+}
+
+// Verify checks that a top-level code unit and its nested functions are safe to execute: valid opcodes,
+// operands within the code, constant and slot indices within their tables, jumps to instruction
+// boundaries and the same stack depth on every path, without underflows or falling off the end.
+func Verify(code *Code) error {
+	if len(code.Upvalues) > 0 {
+		return &VerifyError{Function: code.Name, Msg: "top-level code cannot capture variables"}
+	}
+
+	return verify(code, code.Name)
+}
+
+// verifier holds the state of the verification of a code unit.
+type verifier struct {
+	code         *Code
+	path         string
+	instructions map[int]Instruction
+	offsets      []int // instruction offsets in code order
+}
+
+// verify checks a code unit and its nested functions.
+func verify(code *Code, path string) error {
+	v := &verifier{
+		code:         code,
+		path:         path,
+		instructions: make(map[int]Instruction),
+	}
+
+	if len(code.Params) > len(code.Locals) {
+		return v.error(0, fmt.Sprintf("%d parameters but %d slots", len(code.Params), len(code.Locals)))
+	}
+
+	if len(code.Code) == 0 {
+		return v.error(0, "empty code")
+	}
+
+	for offset := 0; offset < len(code.Code); {
+		ins, err := decode(code, offset)
+		if err != nil {
+			return v.error(offset, err.Error())
+		}
+
+		v.instructions[offset] = ins
+		v.offsets = append(v.offsets, offset)
+		offset = ins.next()
+	}
+
+	for _, offset := range v.offsets {
+		if err := v.checkOperands(v.instructions[offset]); err != nil {
+			return err
+		}
+	}
+
+	if err := v.checkStack(); err != nil {
+		return err
+	}
+
+	for _, fn := range code.Functions {
+		for idx, capture := range fn.Upvalues {
+			if (capture.Local && capture.Index >= len(code.Locals)) || (!capture.Local && capture.Index >= len(code.Upvalues)) {
+				return &VerifyError{Function: path + "/" + fn.Name, Msg: fmt.Sprintf("upvalue %d captures an invalid variable", idx)}
+			}
+		}
+
+		if err := verify(fn, path+"/"+fn.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkOperands checks that the operands of an instruction point into their tables.
+func (v *verifier) checkOperands(ins Instruction) error {
+	def := definitions[ins.Opcode]
+
+	if len(ins.Operands) == 0 {
+		return nil
+	}
+
+	operand, limit := ins.Operands[0], 0
+
+	switch def.kind {
+	case operandConstant:
+		limit = len(v.code.Constants)
+
+		if ins.Opcode == OpGetGlobal || ins.Opcode == OpDefineGlobal || ins.Opcode == OpSetGlobal {
+			if operand < limit && v.code.Constants[operand].Type() != runtime.StringType {
+				return v.error(ins.Offset, fmt.Sprintf("%s name constant %d is not a string", ins.Opcode, operand))
+			}
+		}
+
+	case operandFunction:
+		limit = len(v.code.Functions)
+
+	case operandLocal:
+		limit = len(v.code.Locals)
+
+	case operandUpvalue:
+		limit = len(v.code.Upvalues)
+
+	case operandScope:
+		// the parameters are bound for the whole call
+		if operand < len(v.code.Params) {
+			return v.error(ins.Offset, fmt.Sprintf("%s slot %d is a parameter", ins.Opcode, operand))
+		}
+
+		operand, limit = operand+ins.Operands[1]-1, len(v.code.Locals)
+
+	case operandJump:
+		if _, ok := v.instructions[operand]; !ok {
+			return v.error(ins.Offset, fmt.Sprintf("%s target %04d is not an instruction", ins.Opcode, operand))
+		}
+
+		return nil
+
+	default:
+		return nil
+	}
+
+	if operand >= limit {
+		return v.error(ins.Offset, fmt.Sprintf("%s operand %d out of range (%d entries)", ins.Opcode, operand, limit))
+	}
+
+	return nil
+}
+
+// checkStack follows every path of the code checking the stack depth of each instruction.
+func (v *verifier) checkStack() error {
+	depths := map[int]int{0: 0}
+	pending := []int{0}
+
+	for len(pending) > 0 {
+		offset := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		ins := v.instructions[offset]
+		depth := depths[offset]
+
+		pops, pushes := stackEffect(ins)
+		if depth < pops {
+			return v.error(offset, fmt.Sprintf("stack underflow: %s needs %d values, found %d", ins.Opcode, pops, depth))
+		}
+
+		depth += pushes - pops
+
+		type successor struct{ offset, depth int }
+
+		var successors []successor
+
+		switch ins.Opcode {
+		case OpHalt, OpReturn:
+			if depth != 0 {
+				return v.error(offset, fmt.Sprintf("unbalanced stack: %d values left", depth))
+			}
+		case OpRecur:
+		case OpJump:
+			successors = append(successors, successor{ins.Operands[0], depth})
+		case OpJumpIfFalse:
+			successors = append(successors, successor{ins.next(), depth}, successor{ins.Operands[0], depth})
+		case OpAnd, OpOr:
+			// the operand is pushed back when short-circuiting
+			successors = append(successors, successor{ins.next(), depth}, successor{ins.Operands[0], depth + 1})
+		default:
+			successors = append(successors, successor{ins.next(), depth})
+		}
+
+		for _, succ := range successors {
+			if succ.offset >= len(v.code.Code) {
+				return v.error(offset, "execution falls off the end of the code")
+			}
+
+			seen, ok := depths[succ.offset]
+			if !ok {
+				depths[succ.offset] = succ.depth
+				pending = append(pending, succ.offset)
+
+				continue
+			}
+
+			if seen != succ.depth {
+				return v.error(succ.offset, fmt.Sprintf("inconsistent stack depth: %d and %d", seen, succ.depth))
+			}
+		}
+	}
+
+	return nil
+}
+
+// stackEffect returns the number of values an instruction pops and pushes.
+func stackEffect(ins Instruction) (int, int) {
+	switch ins.Opcode {
+	case OpHalt, OpReturn, OpPop, OpJumpIfFalse, OpAnd, OpOr, OpDefineLocalPop, OpSetLocalPop:
+		return 1, 0
+	case OpDefineGlobal, OpSetGlobal, OpDefineLocal, OpSetLocal, OpSetUpvalue:
+		return 1, 1
+	case OpVector:
+		return ins.Operands[0], 1
+	case OpMap:
+		return 2 * ins.Operands[0], 1
+	case OpCall:
+		return ins.Operands[0] + 1, 1
+	case OpRecur:
+		return ins.Operands[0], 0
+	case OpJump, OpExitScope:
+		return 0, 0
+	default:
+		return 0, 1
+	}
+}
+
+// error makes a verification error.
+func (v *verifier) error(offset int, msg string) *VerifyError {
+	return &VerifyError{Function: v.path, Offset: offset, Msg: msg}
+}
@@ -0,0 +1,188 @@
+package vm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/debug"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+// assemble encodes instructions given as an opcode followed by its operands.
+func assemble(instructions ...[]int) []byte {
+	var code []byte
+
+	for _, ins := range instructions {
+		op := opcode(ins[0])
+		code = append(code, byte(op))
+
+		for idx, width := range definitions[op].operands {
+			code = append(code, encodeOperand(ins[idx+1], width)...)
+		}
+	}
+
+	return code
+}
+
+// codeUnit builds a code unit with parameters, frame slots and constants.
+func codeUnit(params []string, locals []string, constants []runtime.Value, code []byte) *Code {
+	fn := NewCode("fn")
+	fn.Params = params
+	fn.Locals = locals
+	fn.Constants = constants
+	fn.Code = code
+
+	return fn
+}
+
+func TestVerifier(t *testing.T) {
+	one := []runtime.Value{runtime.NewNumber(1)}
+
+	tests := []struct {
+		name string
+		code *Code
+		err  string
+	}{
+		{
+			name: "valid",
+			code: codeUnit(nil, nil, one, assemble([]int{int(OpConst), 0}, []int{int(OpReturn)})),
+		},
+		{
+			name: "scope over a parameter",
+			code: codeUnit([]string{"n"}, []string{"n"}, one, assemble(
+				[]int{int(OpExitScope), 0, 1}, []int{int(OpConst), 0}, []int{int(OpRecur), 1},
+			)),
+			err: "EXIT_SCOPE slot 0 is a parameter",
+		},
+		{
+			name: "scope out of range",
+			code: codeUnit(nil, []string{"x", "y"}, nil, assemble(
+				[]int{int(OpExitScope), 1, 2}, []int{int(OpNil)}, []int{int(OpReturn)},
+			)),
+			err: "EXIT_SCOPE operand 2 out of range (2 entries)",
+		},
+		{
+			name: "local out of range",
+			code: codeUnit(nil, []string{"x"}, nil, assemble([]int{int(OpGetLocal), 1}, []int{int(OpReturn)})),
+			err:  "GET_LOCAL operand 1 out of range (1 entries)",
+		},
+		{
+			name: "constant out of range",
+			code: codeUnit(nil, nil, one, assemble([]int{int(OpConst), 1}, []int{int(OpReturn)})),
+			err:  "CONST operand 1 out of range (1 entries)",
+		},
+		{
+			name: "global name not a string",
+			code: codeUnit(nil, nil, one, assemble([]int{int(OpGetGlobal), 0}, []int{int(OpReturn)})),
+			err:  "GET_GLOBAL name constant 0 is not a string",
+		},
+		{
+			name: "jump into an instruction",
+			code: codeUnit(nil, nil, nil, assemble([]int{int(OpJump), 2}, []int{int(OpNil)}, []int{int(OpReturn)})),
+			err:  "JUMP target 0002 is not an instruction",
+		},
+		{
+			name: "jump out of the code",
+			code: codeUnit(nil, nil, nil, assemble([]int{int(OpJump), 100}, []int{int(OpNil)}, []int{int(OpReturn)})),
+			err:  "JUMP target 0100 is not an instruction",
+		},
+		{
+			name: "unbalanced stack",
+			code: codeUnit(nil, nil, one, assemble([]int{int(OpConst), 0}, []int{int(OpConst), 0}, []int{int(OpReturn)})),
+			err:  "unbalanced stack: 1 values left",
+		},
+		{
+			name: "stack underflow",
+			code: codeUnit(nil, nil, nil, assemble([]int{int(OpPop)}, []int{int(OpNil)}, []int{int(OpReturn)})),
+			err:  "stack underflow: POP needs 1 values, found 0",
+		},
+		{
+			name: "inconsistent stack depth",
+			code: codeUnit(nil, nil, one, assemble(
+				[]int{int(OpTrue)}, []int{int(OpJumpIfFalse), 8}, []int{int(OpConst), 0}, []int{int(OpNil)}, []int{int(OpReturn)},
+			)),
+			err: "inconsistent stack depth",
+		},
+		{
+			name: "falls off the end",
+			code: codeUnit(nil, nil, nil, assemble([]int{int(OpNil)})),
+			err:  "execution falls off the end of the code",
+		},
+		{
+			name: "unknown opcode",
+			code: codeUnit(nil, nil, nil, []byte{0xFF}),
+			err:  "unknown opcode 0xFF",
+		},
+		{
+			name: "truncated operand",
+			code: codeUnit(nil, nil, nil, []byte{byte(OpGetLocal), 0}),
+			err:  "truncated operand of GET_LOCAL",
+		},
+		{
+			name: "more parameters than slots",
+			code: codeUnit([]string{"a", "b"}, []string{"a"}, nil, assemble([]int{int(OpNil)}, []int{int(OpReturn)})),
+			err:  "2 parameters but 1 slots",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Verify(test.code)
+
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("expected valid bytecode, got: %v", err)
+				}
+
+				return
+			}
+
+			var verifyErr *VerifyError
+			if !errors.As(err, &verifyErr) || !strings.Contains(verifyErr.Msg, test.err) {
+				t.Fatalf("expected a verify error containing %q, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifierCaptures(t *testing.T) {
+	main := codeUnit(nil, []string{"x"}, nil, assemble([]int{int(OpClosure), 0}, []int{int(OpReturn)}))
+
+	inner := codeUnit(nil, nil, nil, assemble([]int{int(OpGetUpvalue), 0}, []int{int(OpReturn)}))
+	inner.Name = "inner"
+	inner.Upvalues = []Capture{{Name: "y", Local: true, Index: 1}}
+	main.Functions = []*Code{inner}
+
+	err := Verify(main)
+
+	var verifyErr *VerifyError
+	if !errors.As(err, &verifyErr) || verifyErr.Function != "fn/inner" || verifyErr.Msg != "upvalue 0 captures an invalid variable" {
+		t.Fatalf("expected an invalid capture in `fn/inner`, got: %v", err)
+	}
+
+	main.Upvalues = []Capture{{Name: "z", Local: true, Index: 0}}
+
+	if err := Verify(main); err == nil || !strings.Contains(err.Error(), "top-level code cannot capture variables") {
+		t.Fatalf("expected top-level captures to be rejected, got: %v", err)
+	}
+}
+
+// An unverified recur over a parameter slot cleared by a scope rebinds it instead of crashing.
+func TestRecurClearedParameter(t *testing.T) {
+	loop := codeUnit([]string{"n"}, []string{"n"}, []runtime.Value{runtime.NewNumber(1)}, assemble(
+		[]int{int(OpExitScope), 0, 1}, []int{int(OpConst), 0}, []int{int(OpRecur), 1},
+	))
+
+	main := codeUnit(nil, nil, []runtime.Value{runtime.NewNumber(0)}, assemble(
+		[]int{int(OpClosure), 0}, []int{int(OpConst), 0}, []int{int(OpCall), 1}, []int{int(OpHalt)},
+	))
+	main.Functions = []*Code{loop}
+
+	_, err := NewVirtualMachine(WithStepLimit(100)).Execute(main)
+
+	var limitErr *debug.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != debug.StepLimit {
+		t.Fatalf("expected the step limit, got: %v", err)
+	}
+}
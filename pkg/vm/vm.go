@@ -2,140 +2,840 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/danielspk/tatu-lang/pkg/core"
+	"github.com/danielspk/tatu-lang/pkg/core/profile"
+	"github.com/danielspk/tatu-lang/pkg/debug"
+	"github.com/danielspk/tatu-lang/pkg/location"
 	"github.com/danielspk/tatu-lang/pkg/runtime"
 )
 
 const (
-	StackLimit = 512
+	StackLimit     = 16384 // default maximum number of values on the stack
+	CallDepthLimit = 4096  // default maximum number of nested function calls
+
+	checkInterval = 1024 // number of instructions between checks of the execution context
 )
 
-// VirtualMachine ...
+// Upvalue is a variable cell shared by a frame slot and the closures that capture it.
+// A nil value means the variable is not defined yet.
+type Upvalue struct {
+	Value runtime.Value
+}
+
+// Closure represents a compiled function value with the variables it captured when it was created.
+type Closure struct {
+	Function *Code
+	Upvalues []*Upvalue
+}
+
+// NewClosure builds a new Closure.
+func NewClosure(function *Code, upvalues []*Upvalue) *Closure {
+	return &Closure{
+		Function: function,
+		Upvalues: upvalues,
+	}
+}
+
+// Type returns the type of the closure value.
+func (cl *Closure) Type() runtime.ValueType {
+	return runtime.FuncType
+}
+
+// String returns the string representation of the closure value.
+func (cl *Closure) String() string {
+	return "Function()"
+}
+
+// Equal compares the closure value to another.
+func (cl *Closure) Equal(_ runtime.Value) bool {
+	return false
+}
+
+// frame represents the activation of a closure.
+type frame struct {
+	closure *Closure
+	ip      uint
+	op      uint       // offset of the instruction being executed
+	base    uint       // stack pointer when the frame was entered
+	slots   []*Upvalue // parameters and local variables
+}
+
+// VirtualMachine represents a stack-based virtual machine.
 type VirtualMachine struct {
-	ip        uint
 	sp        uint
-	code      []byte
-	stack     [StackLimit]runtime.Value
-	constants []runtime.Value
+	stack     []runtime.Value
+	frames    []frame
+	frame     *frame
+	callLimit int
+	global    *runtime.Environment
+	stepLimit int
+	timeout   time.Duration
+	ctx       context.Context
+	steps     int
+	memory    *runtime.MemoryLimits
+	modules   []runtime.Module
+	running   bool // an execution is in progress
+}
+
+// Option configures a VirtualMachine.
+type Option func(vm *VirtualMachine)
+
+// WithStackSize sets the maximum number of values on the stack.
+func WithStackSize(size int) Option {
+	return func(vm *VirtualMachine) {
+		if size > 0 {
+			vm.stack = make([]runtime.Value, size)
+		}
+	}
+}
+
+// WithCallDepth sets the maximum number of nested function calls.
+func WithCallDepth(depth int) Option {
+	return func(vm *VirtualMachine) {
+		if depth > 0 {
+			vm.callLimit = depth
+		}
+	}
+}
+
+// WithStepLimit limits the number of instructions of each call to Execute.
+func WithStepLimit(steps int) Option {
+	return func(vm *VirtualMachine) {
+		vm.stepLimit = steps
+	}
 }
 
-// NewVirtualMachine ...
-func NewVirtualMachine() *VirtualMachine {
-	return &VirtualMachine{
-		ip:        0,
+// WithTimeout limits the wall-clock duration of each call to Execute.
+func WithTimeout(timeout time.Duration) Option {
+	return func(vm *VirtualMachine) {
+		vm.timeout = timeout
+	}
+}
+
+// WithMemoryLimits caps the strings and collections a program can build and its total allocation per call to Execute.
+// The limits apply to the global scope of the virtual machine, shared with any other user of that scope.
+func WithMemoryLimits(limits runtime.MemoryLimits) Option {
+	return func(vm *VirtualMachine) {
+		vm.memory = &limits
+	}
+}
+
+// WithEnvironment runs the programs against the given global scope instead of a new one
+// with the builtins and the standard library, e.g. to share the bindings with an interpreter.
+func WithEnvironment(env *runtime.Environment) Option {
+	return func(vm *VirtualMachine) {
+		vm.global = env
+	}
+}
+
+// WithModules registers only the given modules in the new global scope instead of every one (profile.Full),
+// e.g. `WithModules(profile.Pure()...)` to deny file system access. It has no effect together with WithEnvironment.
+func WithModules(modules ...runtime.Module) Option {
+	return func(vm *VirtualMachine) {
+		vm.modules = modules
+	}
+}
+
+// NewVirtualMachine builds a new VirtualMachine.
+func NewVirtualMachine(opts ...Option) *VirtualMachine {
+	vm := &VirtualMachine{
 		sp:        0,
-		code:      make([]byte, 0),
-		constants: make([]runtime.Value, 0),
+		callLimit: CallDepthLimit,
+		modules:   profile.Full(),
+	}
+
+	for _, opt := range opts {
+		opt(vm)
+	}
+
+	if vm.stack == nil {
+		vm.stack = make([]runtime.Value, StackLimit)
+	}
+
+	if vm.global == nil {
+		vm.global = runtime.NewEnvironment(nil, nil)
+		profile.Register(vm.global, vm.modules)
+	}
+
+	if vm.memory != nil {
+		vm.global.Memory().SetLimits(*vm.memory)
 	}
+
+	return vm
 }
 
-// Execute ...
+// NewEnvironment builds a global scope with the given modules, or with every one (profile.Full) when none is given.
+func NewEnvironment(modules ...runtime.Module) *runtime.Environment {
+	global := runtime.NewEnvironment(nil, nil)
+
+	if len(modules) == 0 {
+		modules = profile.Full()
+	}
+
+	profile.Register(global, modules)
+
+	return global
+}
+
+// Globals returns the user-defined global variables.
+func (vm *VirtualMachine) Globals() map[string]runtime.Value {
+	return vm.global.Variables()
+}
+
+// Register defines a Go function as a native in the global scope, converting its arguments and result
+// between Tatu values and Go values (see core.NewGoFunction).
+func (vm *VirtualMachine) Register(name string, fn any) error {
+	return core.RegisterGoFunction(vm.global, name, fn)
+}
+
+// Execute runs the code of a compiled program and returns the resulting value.
+// Global bindings are kept between executions.
 func (vm *VirtualMachine) Execute(code *Code) (runtime.Value, error) {
-	// TODO test >>>>
-	//vm.constants = append(vm.constants, NewNumber(2))
-	//vm.constants = append(vm.constants, NewNumber(3))
-	//vm.constants = append(vm.constants, NewString("hola "))
-	//vm.constants = append(vm.constants, NewString("mundo"))
+	return vm.ExecuteContext(context.Background(), code)
+}
 
-	//program = []byte{
-	//	byte(OpConst), 0, byte(OpConst), 1, byte(OpAdd), 0x00,
-	//}
-	// TODO test <<<<
+// ExecuteContext runs the code of a compiled program until it finishes, the context is done or an execution limit is hit.
+// Stopped executions return a *debug.LimitError.
+func (vm *VirtualMachine) ExecuteContext(ctx context.Context, code *Code) (runtime.Value, error) {
+	cancel := vm.start(ctx)
+	defer cancel()
 
-	// TODO check this
-	vm.code = code.Code
-	vm.constants = code.Constants
+	return vm.run(NewClosure(code, nil), nil)
+}
 
-	// parsing the program
+// Call calls a function value, e.g. a closure taken from Globals, with the given arguments and returns its result.
+// Errors raised inside the function keep their source location.
+func (vm *VirtualMachine) Call(fn runtime.Value, args ...runtime.Value) (runtime.Value, error) {
+	return vm.CallContext(context.Background(), fn, args...)
+}
 
-	// compile the program
+// CallContext calls a function value until it returns, the context is done or an execution limit is hit.
+// Stopped calls return a *debug.LimitError. A call made while an evaluation is running, e.g. from a registered
+// Go function, is nested in it: it shares its limits and ignores ctx.
+func (vm *VirtualMachine) CallContext(ctx context.Context, fn runtime.Value, args ...runtime.Value) (runtime.Value, error) {
+	cancel := vm.start(ctx)
+	defer cancel()
 
-	// init instruction pointer (or program counter)
-	//vm.ip = int(vm.code[0])
+	return vm.callback(fn, args...)
+}
 
-	return vm.eval()
+// CallGlobal calls the function bound to a name in the global scope, e.g. `CallGlobal("on-event", event)`.
+func (vm *VirtualMachine) CallGlobal(name string, args ...runtime.Value) (runtime.Value, error) {
+	fn, found := vm.global.Lookup(name)
+	if !found {
+		return nil, vm.error(fmt.Sprintf("unknown symbol `%s`", name))
+	}
+
+	return vm.Call(fn, args...)
 }
 
-// eval ...
-func (vm *VirtualMachine) eval() (runtime.Value, error) {
+// start resets the execution limits and the stack for a new execution. Nested executions, e.g. a Call from a
+// registered Go function, run on top of the stack of the outer one, within its limits and memory accounting,
+// ignoring their own context.
+func (vm *VirtualMachine) start(ctx context.Context) context.CancelFunc {
+	if vm.running {
+		return func() {}
+	}
+
+	cancel := context.CancelFunc(func() {})
+
+	if vm.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, vm.timeout)
+	}
+
+	vm.ctx, vm.steps = ctx, 0
+	vm.global.Memory().Reset()
+	vm.sp = 0
+	vm.frames = vm.frames[:0]
+	vm.frame = nil
+	vm.running = true
+
+	return func() {
+		cancel()
+		vm.running = false
+	}
+}
+
+// run calls a closure and evaluates it until it returns, restoring the caller state on failure.
+func (vm *VirtualMachine) run(closure *Closure, args []runtime.Value) (runtime.Value, error) {
+	entry, sp := len(vm.frames), vm.sp
+
+	err := vm.enter(closure, args)
+
+	var result runtime.Value
+
+	if err == nil {
+		result, err = vm.eval(entry)
+	}
+
+	if err != nil {
+		vm.sp = sp
+		vm.leave(entry)
+
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// eval evaluates instructions until the frame at the entry depth returns.
+func (vm *VirtualMachine) eval(entry int) (runtime.Value, error) {
 	for {
+		frame := vm.frame
+		code := frame.closure.Function
+
+		frame.op = frame.ip
 		op := opcode(vm.readByte())
 
+		vm.steps++
+
+		if vm.stepLimit > 0 && vm.steps > vm.stepLimit {
+			return nil, vm.limitError(debug.NewStepLimitError(vm.stepLimit))
+		}
+
+		if vm.steps%checkInterval == 0 && vm.ctx != nil {
+			if err := vm.ctx.Err(); err != nil {
+				return nil, vm.limitError(debug.NewContextLimitError(err))
+			}
+		}
+
+		var err error
+
 		switch op {
-		case OpHalt:
-			return vm.stackPop(), nil
+		case OpHalt, OpReturn:
+			var result runtime.Value
+
+			if result, err = vm.stackPop(); err != nil {
+				break
+			}
+
+			vm.sp = frame.base
+			vm.leave(len(vm.frames) - 1)
+
+			if len(vm.frames) == entry {
+				return result, nil
+			}
+
+			err = vm.stackPush(result)
 
 		case OpConst:
-			constIdx := vm.readByte()
-			value := vm.constants[constIdx]
-			vm.stackPush(value)
+			constIdx := vm.readOperand(constWidth)
+			err = vm.stackPush(code.Constants[constIdx])
+
+		case OpConstLong:
+			constIdx := vm.readOperand(constLongWidth)
+			err = vm.stackPush(code.Constants[constIdx])
+
+		case OpNil:
+			err = vm.stackPush(runtime.NewNil())
+
+		case OpTrue:
+			err = vm.stackPush(runtime.NewBool(true))
+
+		case OpFalse:
+			err = vm.stackPush(runtime.NewBool(false))
+
+		case OpPop:
+			_, err = vm.stackPop()
+
+		case OpGetGlobal:
+			name := vm.readName()
+
+			value, found := vm.global.Lookup(name)
+			if !found {
+				return nil, vm.error(fmt.Sprintf("unknown symbol `%s`", name))
+			}
 
-		case OpAdd:
-			op2 := vm.stackPop()
-			op1 := vm.stackPop()
+			err = vm.stackPush(value)
 
-			if op1.Type() == runtime.NumberType && op2.Type() == runtime.NumberType {
-				vm.stackPush(runtime.NewNumber(op1.(runtime.Number).Value + op2.(runtime.Number).Value))
+		case OpDefineGlobal:
+			name := vm.readName()
+
+			var value runtime.Value
+
+			if value, err = vm.stackPeek(); err != nil {
+				break
+			}
+
+			if _, err := vm.global.Define(name, value); err != nil {
+				return nil, vm.error(err.Error())
+			}
+
+		case OpSetGlobal:
+			name := vm.readName()
+
+			var value runtime.Value
+
+			if value, err = vm.stackPeek(); err != nil {
+				break
+			}
+
+			if err := vm.global.Assign(name, value); err != nil {
+				return nil, vm.error(err.Error())
+			}
+
+		case OpGetLocal:
+			slot := vm.readOperand(localWidth)
+
+			upvalue := frame.slots[slot]
+			if upvalue == nil || upvalue.Value == nil {
+				return nil, vm.error(fmt.Sprintf("unknown symbol `%s`", code.Locals[slot]))
+			}
+
+			err = vm.stackPush(upvalue.Value)
+
+		case OpDefineLocal, OpDefineLocalPop:
+			slot := vm.readOperand(localWidth)
+			name := code.Locals[slot]
+
+			var value runtime.Value
+
+			if op == OpDefineLocalPop {
+				value, err = vm.stackPop()
 			} else {
-				vm.stackPush(runtime.NewString(op1.String() + op2.String()))
+				value, err = vm.stackPeek()
+			}
+
+			if err != nil {
+				break
+			}
+
+			if vm.global.IsNative(name) {
+				return nil, vm.error(fmt.Sprintf("cannot redefine native `%s`", name))
+			}
+
+			// a closure created by the initializer may have captured the slot already
+			upvalue := frame.slots[slot]
+
+			switch {
+			case upvalue == nil:
+				frame.slots[slot] = &Upvalue{Value: value}
+			case upvalue.Value == nil:
+				upvalue.Value = value
+			default:
+				return nil, vm.error(fmt.Sprintf("symbol `%s` already defined", name))
+			}
+
+		case OpSetLocal, OpSetLocalPop:
+			slot := vm.readOperand(localWidth)
+
+			var value runtime.Value
+
+			if op == OpSetLocalPop {
+				value, err = vm.stackPop()
+			} else {
+				value, err = vm.stackPeek()
+			}
+
+			if err != nil {
+				break
+			}
+
+			upvalue := frame.slots[slot]
+			if upvalue == nil || upvalue.Value == nil {
+				return nil, vm.error(fmt.Sprintf("undefined variable `%s`", code.Locals[slot]))
+			}
+
+			upvalue.Value = value
+
+		case OpGetUpvalue:
+			idx := vm.readOperand(upvalueWidth)
+
+			upvalue := frame.closure.Upvalues[idx]
+			if upvalue.Value == nil {
+				return nil, vm.error(fmt.Sprintf("unknown symbol `%s`", code.Upvalues[idx].Name))
+			}
+
+			err = vm.stackPush(upvalue.Value)
+
+		case OpSetUpvalue:
+			idx := vm.readOperand(upvalueWidth)
+
+			var value runtime.Value
+
+			if value, err = vm.stackPeek(); err != nil {
+				break
+			}
+
+			upvalue := frame.closure.Upvalues[idx]
+			if upvalue.Value == nil {
+				return nil, vm.error(fmt.Sprintf("undefined variable `%s`", code.Upvalues[idx].Name))
+			}
+
+			upvalue.Value = value
+
+		case OpExitScope:
+			first := vm.readOperand(localWidth)
+			count := vm.readOperand(localWidth)
+
+			clear(frame.slots[first : first+count])
+
+		case OpJump:
+			frame.ip = uint(vm.readOperand(jumpWidth))
+
+		case OpJumpIfFalse:
+			target := vm.readOperand(jumpWidth)
+
+			var value runtime.Value
+
+			if value, err = vm.stackPop(); err != nil {
+				break
 			}
 
-		case OpSub:
-			num1, num2 := vm.binaryOperation()
-			vm.stackPush(runtime.NewNumber(num1 - num2))
+			b, ok := value.(runtime.Bool)
+			if !ok {
+				return nil, vm.error(fmt.Sprintf("expected BOOL, found %s", value.Type()))
+			}
+
+			if !b.Value {
+				frame.ip = uint(target)
+			}
+
+		case OpAnd, OpOr:
+			target := vm.readOperand(jumpWidth)
+
+			var value runtime.Value
+
+			if value, err = vm.stackPop(); err != nil {
+				break
+			}
+
+			operator := "and"
+			if op == OpOr {
+				operator = "or"
+			}
 
-		case OpMul:
-			num1, num2 := vm.binaryOperation()
-			vm.stackPush(runtime.NewNumber(num1 * num2))
+			b, ok := value.(runtime.Bool)
+			if !ok {
+				return nil, vm.error(fmt.Sprintf("invalid type %s for `%s`", value.Type(), operator))
+			}
+
+			if b.Value == (op == OpOr) {
+				err = vm.stackPush(b)
+				frame.ip = uint(target)
+			}
+
+		case OpVector:
+			var elements []runtime.Value
+
+			count := vm.readOperand(countWidth)
 
-		case OpDiv:
-			num1, num2 := vm.binaryOperation()
-			if num2 == 0 {
-				return nil, fmt.Errorf("division by zero")
+			if err = vm.global.Memory().AllocElements(count, count); err != nil {
+				err = vm.nativeError(err)
+				break
 			}
 
-			vm.stackPush(runtime.NewNumber(num1 / num2))
+			if elements, err = vm.stackPopN(count); err != nil {
+				break
+			}
+
+			err = vm.stackPush(runtime.NewVector(elements))
+
+		case OpMap:
+			var pairs []runtime.Value
+
+			count := vm.readOperand(countWidth)
+
+			if err = vm.global.Memory().AllocElements(count, count); err != nil {
+				err = vm.nativeError(err)
+				break
+			}
+
+			if pairs, err = vm.stackPopN(2 * count); err != nil {
+				break
+			}
+
+			elements := make(map[string]runtime.Value, len(pairs)/2)
+
+			for idx := 0; idx < len(pairs); idx += 2 {
+				key, ok := pairs[idx].(runtime.String)
+				if !ok {
+					return nil, vm.error(fmt.Sprintf("invalid map key type: expected string, got %s", pairs[idx].Type()))
+				}
+
+				elements[key.Value] = pairs[idx+1]
+			}
+
+			err = vm.stackPush(runtime.NewMap(elements))
+
+		case OpClosure:
+			fn := code.Functions[vm.readOperand(functionWidth)]
+			upvalues := make([]*Upvalue, len(fn.Upvalues))
+
+			for idx, capture := range fn.Upvalues {
+				if !capture.Local {
+					upvalues[idx] = frame.closure.Upvalues[capture.Index]
+					continue
+				}
+
+				if frame.slots[capture.Index] == nil {
+					frame.slots[capture.Index] = &Upvalue{}
+				}
+
+				upvalues[idx] = frame.slots[capture.Index]
+			}
+
+			err = vm.stackPush(NewClosure(fn, upvalues))
+
+		case OpCall:
+			var values []runtime.Value
+
+			if values, err = vm.stackPopN(vm.readOperand(argsWidth) + 1); err != nil {
+				break
+			}
+
+			err = vm.call(values[0], values[1:])
+
+		case OpRecur:
+			var args []runtime.Value
+
+			if args, err = vm.stackPopN(vm.readOperand(argsWidth)); err != nil {
+				break
+			}
+
+			err = vm.recur(args)
 
 		default:
-			return nil, fmt.Errorf("unknown opcode 0x%X", op)
+			return nil, vm.error(fmt.Sprintf("unknown opcode 0x%X", byte(op)))
+		}
+
+		if err != nil {
+			return nil, err
 		}
 	}
 }
 
+// call calls a native function pushing its result, or enters a closure.
+func (vm *VirtualMachine) call(callee runtime.Value, args []runtime.Value) error {
+	switch fn := callee.(type) {
+	case runtime.NativeFunction:
+		result, err := vm.callNative(fn, args)
+		if err != nil {
+			return err
+		}
+
+		return vm.stackPush(result)
+
+	case *Closure:
+		return vm.enter(fn, args)
+
+	default:
+		return vm.error("expression is not a function")
+	}
+}
+
+// callback is the Caller natives use to call back functions, running closures until they return.
+func (vm *VirtualMachine) callback(fn runtime.Value, args ...runtime.Value) (runtime.Value, error) {
+	switch fn := fn.(type) {
+	case runtime.NativeFunction:
+		return vm.callNative(fn, args)
+
+	case *Closure:
+		return vm.run(fn, args)
+
+	case nil:
+		return nil, vm.error("cannot call nil: value is not a function")
+
+	default:
+		return nil, vm.error(fmt.Sprintf("cannot call %s: value is not a function", fn.Type()))
+	}
+}
+
+// callNative calls a native function, giving it the callback when it calls back functions.
+func (vm *VirtualMachine) callNative(fn runtime.NativeFunction, args []runtime.Value) (runtime.Value, error) {
+	var call runtime.Caller
+
+	if fn.Callback != nil {
+		call = vm.callback
+	}
+
+	result, err := fn.Call(call, args...)
+	if err != nil {
+		return nil, vm.nativeError(err)
+	}
+
+	return result, nil
+}
+
+// enter pushes the frame of a closure binding its arguments to the parameter slots.
+func (vm *VirtualMachine) enter(closure *Closure, args []runtime.Value) error {
+	fn := closure.Function
+
+	if len(args) != len(fn.Params) {
+		return vm.error(fmt.Sprintf("expected %d arguments, got %d", len(fn.Params), len(args)))
+	}
+
+	if len(vm.frames) == vm.callLimit {
+		return vm.error(fmt.Sprintf("stack overflow: exceeded %d nested calls", vm.callLimit))
+	}
+
+	slots := make([]*Upvalue, len(fn.Locals))
+
+	for idx, arg := range args {
+		slots[idx] = &Upvalue{Value: arg}
+	}
+
+	vm.frames = append(vm.frames, frame{closure: closure, base: vm.sp, slots: slots})
+	vm.frame = &vm.frames[len(vm.frames)-1]
+
+	return nil
+}
+
+// leave pops the frames above the given depth.
+func (vm *VirtualMachine) leave(depth int) {
+	clear(vm.frames[depth:])
+	vm.frames = vm.frames[:depth]
+	vm.frame = nil
+
+	if depth > 0 {
+		vm.frame = &vm.frames[depth-1]
+	}
+}
+
+// recur restarts the current frame with new arguments in constant stack space.
+// Parameters are updated in place so the closures that captured them see the new values, like the interpreter.
+func (vm *VirtualMachine) recur(args []runtime.Value) error {
+	frame := vm.frame
+	fn := frame.closure.Function
+
+	if len(args) != len(fn.Params) {
+		// reported at the call, like the interpreter
+		if len(vm.frames) > 1 {
+			vm.frame = &vm.frames[len(vm.frames)-2]
+		}
+
+		return vm.error(fmt.Sprintf("expected %d arguments, got %d", len(fn.Params), len(args)))
+	}
+
+	for idx, arg := range args {
+		if frame.slots[idx] == nil {
+			frame.slots[idx] = &Upvalue{}
+		}
+
+		frame.slots[idx].Value = arg
+	}
+
+	clear(frame.slots[len(args):])
+
+	frame.ip = 0
+	vm.sp = frame.base
+
+	return nil
+}
+
 // readByte ...
 func (vm *VirtualMachine) readByte() byte {
-	b := vm.code[vm.ip]
-	vm.ip++
+	b := vm.frame.closure.Function.Code[vm.frame.ip]
+	vm.frame.ip++
 
 	return b
 }
 
-// stackPush ...
-func (vm *VirtualMachine) stackPush(value runtime.Value) {
-	if vm.sp == StackLimit {
-		// TODO error stack overflow
+// readOperand reads an operand of the given width.
+func (vm *VirtualMachine) readOperand(width int) int {
+	v := readOperand(vm.frame.closure.Function.Code[vm.frame.ip:], width)
+	vm.frame.ip += uint(width)
+
+	return v
+}
+
+// readName reads a constant operand holding the name of a binding.
+func (vm *VirtualMachine) readName() string {
+	return vm.frame.closure.Function.Constants[vm.readOperand(nameWidth)].(runtime.String).Value
+}
+
+// stackPush pushes a value onto the stack.
+func (vm *VirtualMachine) stackPush(value runtime.Value) error {
+	if vm.sp == uint(len(vm.stack)) {
+		return vm.error(fmt.Sprintf("stack overflow: exceeded %d values", len(vm.stack)))
 	}
 
 	vm.stack[vm.sp] = value
 	vm.sp++
+
+	return nil
 }
 
-// stackPop ...
-func (vm *VirtualMachine) stackPop() runtime.Value {
+// stackPop pops the top of the stack.
+func (vm *VirtualMachine) stackPop() (runtime.Value, error) {
 	if vm.sp == 0 {
-		// TODO error empty stack
+		return nil, vm.error("stack underflow: pop from an empty stack")
 	}
 
 	vm.sp--
 
-	return vm.stack[vm.sp]
+	return vm.stack[vm.sp], nil
 }
 
-// binaryOperation ...
-func (vm *VirtualMachine) binaryOperation() (float64, float64) {
-	op2 := vm.stackPop()
-	op1 := vm.stackPop()
+// stackPopN pops the top N values of the stack preserving their order.
+func (vm *VirtualMachine) stackPopN(n int) ([]runtime.Value, error) {
+	if uint(n) > vm.sp {
+		return nil, vm.error(fmt.Sprintf("stack underflow: pop %d values from a stack of %d", n, vm.sp))
+	}
+
+	values := make([]runtime.Value, n)
+	copy(values, vm.stack[vm.sp-uint(n):vm.sp])
+
+	vm.sp -= uint(n)
+
+	return values, nil
+}
 
-	return op1.(runtime.Number).Value, op2.(runtime.Number).Value
+// stackPeek returns the top of the stack without removing it.
+func (vm *VirtualMachine) stackPeek() (runtime.Value, error) {
+	if vm.sp == 0 {
+		return nil, vm.error("stack underflow: peek an empty stack")
+	}
+
+	return vm.stack[vm.sp-1], nil
+}
+
+// nativeError locates an error of a native function or an allocation, keeping limit errors distinguishable.
+// Errors of the functions called back by the native are already located.
+func (vm *VirtualMachine) nativeError(err error) error {
+	if tatuErr, ok := err.(*debug.Error); ok {
+		return tatuErr
+	}
+
+	var limitErr *debug.LimitError
+
+	if errors.As(err, &limitErr) {
+		if limitErr.Line > 0 {
+			return limitErr
+		}
+
+		return vm.limitError(limitErr)
+	}
+
+	return vm.error(err.Error())
+}
+
+// limitError locates a limit error at the instruction being executed.
+func (vm *VirtualMachine) limitError(err *debug.LimitError) *debug.LimitError {
+	located := vm.error(err.Msg)
+	err.Line, err.Column, err.File = located.Line, located.Column, located.File
+
+	return err
+}
+
+// error makes an error located at the instruction being executed.
+func (vm *VirtualMachine) error(msg string) *debug.Error {
+	var loc location.Location
+
+	if vm.frame != nil {
+		loc, _ = vm.frame.closure.Function.LocationAt(int(vm.frame.op))
+	}
+
+	return &debug.Error{
+		Msg:      msg,
+		Line:     loc.End.Line,
+		Column:   loc.End.Column,
+		File:     loc.File,
+		Location: loc,
+	}
 }
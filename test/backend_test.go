@@ -0,0 +1,80 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/ast"
+	"github.com/danielspk/tatu-lang/pkg/interpreter"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+	"github.com/danielspk/tatu-lang/pkg/vm"
+)
+
+// backendNames are the language backends the tests run on.
+var backendNames = []string{"interp", "vm"}
+
+// host is the API a language backend offers to the Go programs embedding it.
+type host interface {
+	Globals() map[string]runtime.Value
+	Register(name string, fn any) error
+	Call(fn runtime.Value, args ...runtime.Value) (runtime.Value, error)
+	CallContext(ctx context.Context, fn runtime.Value, args ...runtime.Value) (runtime.Value, error)
+	CallGlobal(name string, args ...runtime.Value) (runtime.Value, error)
+}
+
+// backendOptions holds the options each language backend is built with.
+type backendOptions struct {
+	interpreter []interpreter.Option
+	vm          []vm.Option
+}
+
+// backend is a language backend built for a test: the interpreter, or the virtual machine running the verified
+// code of the compiler.
+type backend struct {
+	host
+	eval func(ctx context.Context, program *ast.AST) (runtime.Value, error)
+}
+
+// newBackend builds a language backend by name with its options.
+func newBackend(name string, opts backendOptions) *backend {
+	if name == "interp" {
+		inter := interpreter.NewInterpreter(opts.interpreter...)
+
+		return &backend{host: inter, eval: func(ctx context.Context, program *ast.AST) (runtime.Value, error) {
+			return inter.EvalProgramContext(ctx, program, nil)
+		}}
+	}
+
+	machine := vm.NewVirtualMachine(opts.vm...)
+
+	return &backend{host: machine, eval: func(ctx context.Context, program *ast.AST) (runtime.Value, error) {
+		compiler := vm.NewCompiler()
+
+		code, err := compiler.Compile(program)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := vm.Verify(code); err != nil {
+			return nil, err
+		}
+
+		return machine.ExecuteContext(ctx, code)
+	}}
+}
+
+// run evaluates a program.
+func (b *backend) run(program *ast.AST) (runtime.Value, error) {
+	return b.eval(context.Background(), program)
+}
+
+// load evaluates a source defining the functions a test calls, failing the test on errors.
+func (b *backend) load(t *testing.T, source string) *backend {
+	t.Helper()
+
+	if _, err := b.run(buildProgram(t, source)); err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
@@ -0,0 +1,65 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/builder"
+	"github.com/danielspk/tatu-lang/pkg/debug"
+)
+
+func TestIncludeError(t *testing.T) {
+	dir := t.TempDir()
+
+	main := filepath.Join(dir, "main.tatu")
+	lib := filepath.Join(dir, "lib", "lib.tatu")
+	inner := filepath.Join(dir, "lib", "inner.tatu")
+
+	// the files are read from memory
+	files := map[string]string{
+		lib:   `(include "inner.tatu")`,
+		inner: "(def f (x)\n  (+ x 1)\n",
+	}
+
+	readFile := func(filename string) ([]byte, error) {
+		if source, ok := files[filename]; ok {
+			return []byte(source), nil
+		}
+
+		return nil, os.ErrNotExist
+	}
+
+	pb := builder.NewProgramBuilderWithDefaults(builder.WithReadFile(readFile))
+
+	_, _, err := pb.BuildFromSource([]byte("(var x 1)\n  (include \"lib/lib.tatu\")\n"), main)
+
+	var incErr *builder.IncludeError
+	if !errors.As(err, &incErr) {
+		t.Fatalf("expected an include error, got %v", err)
+	}
+
+	if incErr.File != lib || incErr.IncludedBy != main {
+		t.Errorf("expected `%s` included by `%s`, got `%s` included by `%s`", lib, main, incErr.File, incErr.IncludedBy)
+	}
+
+	if loc := incErr.Location; loc.Start.Line != 2 || loc.Start.Column != 3 || loc.End.Column != 27 {
+		t.Errorf("expected the include expression from 2:3 to 2:27, got %v", loc)
+	}
+
+	// the nested include and the located error of the innermost file
+	var nested *builder.IncludeError
+	if !errors.As(incErr.Err, &nested) || nested.File != inner || nested.IncludedBy != lib {
+		t.Errorf("expected `%s` included by `%s`, got %v", inner, lib, incErr.Err)
+	}
+
+	var tatuErr *debug.Error
+	if !errors.As(err, &tatuErr) || tatuErr.File != inner || tatuErr.Msg != "unclosed parenthesis" {
+		t.Errorf("expected an unclosed parenthesis in `%s`, got %v", inner, err)
+	}
+
+	if got := builder.ResolvePath(main, "lib/lib.tatu"); got != lib {
+		t.Errorf("expected the include resolved to `%s`, got `%s`", lib, got)
+	}
+}
@@ -0,0 +1,220 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielspk/tatu-lang/pkg/core/profile"
+	"github.com/danielspk/tatu-lang/pkg/debug"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+const handlers = `
+(var count 0)
+(def on-event (e)
+  (block
+    (set count (+ count 1))
+    (str:concat "got " (map:get e "name"))))
+(def countdown (n) (if (= n 0) "done" (recur (- n 1))))
+(def make-adder (n) (lambda (x) (+ x n)))
+(def fail (x)
+  (- x "a"))
+(def spin () (recur))
+`
+
+func TestCallFunctions(t *testing.T) {
+	event := runtime.NewMap(map[string]runtime.Value{"name": runtime.NewString("click")})
+
+	for _, name := range backendNames {
+		t.Run(name, func(t *testing.T) {
+			backend := newBackend(name, backendOptions{}).load(t, handlers)
+
+			for range 3 {
+				result, err := backend.CallGlobal("on-event", event)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if result.String() != "got click" {
+					t.Errorf("expected %q, got %q", "got click", result.String())
+				}
+			}
+
+			if count := backend.Globals()["count"]; count.String() != "3" {
+				t.Errorf("expected the handler to run 3 times, got %s", count)
+			}
+
+			result, err := backend.CallGlobal("countdown", runtime.NewNumber(100000))
+			if err != nil || result.String() != "done" {
+				t.Errorf("expected tail calls to finish, got %v, %v", result, err)
+			}
+
+			adder, err := backend.CallGlobal("make-adder", runtime.NewNumber(10))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			result, err = backend.Call(adder, runtime.NewNumber(5))
+			if err != nil || result.String() != "15" {
+				t.Errorf("expected 15, got %v, %v", result, err)
+			}
+
+			result, err = backend.Call(backend.Globals()["countdown"], runtime.NewNumber(3))
+			if err != nil || result.String() != "done" {
+				t.Errorf("expected done, got %v, %v", result, err)
+			}
+		})
+	}
+}
+
+func TestCallFunctionErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		call   func(backend host) (runtime.Value, error)
+		expect string
+	}{
+		{
+			"located error",
+			func(backend host) (runtime.Value, error) { return backend.CallGlobal("fail", runtime.NewNumber(1)) },
+			"[Line 10][Column 12] Error: `-` invalid type STRING",
+		},
+		{
+			"arity",
+			func(backend host) (runtime.Value, error) { return backend.CallGlobal("countdown") },
+			"Error: expected 1 arguments, got 0",
+		},
+		{
+			"unknown",
+			func(backend host) (runtime.Value, error) { return backend.CallGlobal("missing") },
+			"Error: unknown symbol `missing`",
+		},
+		{
+			"not a function",
+			func(backend host) (runtime.Value, error) { return backend.CallGlobal("count") },
+			"Error: cannot call NUMBER: value is not a function",
+		},
+		{
+			"nil",
+			func(backend host) (runtime.Value, error) { return backend.Call(nil) },
+			"Error: cannot call nil: value is not a function",
+		},
+		{
+			"native",
+			func(backend host) (runtime.Value, error) {
+				return backend.CallGlobal("str:upper", runtime.NewNumber(1))
+			},
+			"Error: `str:upper` expects STRING at argument 1, got NUMBER",
+		},
+	}
+
+	for _, name := range backendNames {
+		backend := newBackend(name, backendOptions{}).load(t, handlers)
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				result, err := tt.call(backend)
+				if err == nil {
+					t.Fatalf("expected error %q, got value %v", tt.expect, result)
+				}
+
+				if !strings.HasSuffix(err.Error(), tt.expect) {
+					t.Errorf("expected error %q, got %q", tt.expect, err.Error())
+				}
+			})
+		}
+
+		t.Run(name+"/context", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			_, err := backend.CallContext(ctx, backend.Globals()["spin"])
+
+			var limitErr *debug.LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != debug.DeadlineLimit {
+				t.Fatalf("expected a deadline limit error, got %v", err)
+			}
+
+			if result, err := backend.CallGlobal("countdown", runtime.NewNumber(2)); err != nil {
+				t.Errorf("expected the backend to be usable after a stopped call, got %v, %v", result, err)
+			}
+		})
+	}
+}
+
+func TestCallbackErrorLocation(t *testing.T) {
+	const source = `
+(vec:map (vector 1 2)
+  (lambda (x)
+    (- x "a")))
+`
+
+	for _, name := range backendNames {
+		t.Run(name, func(t *testing.T) {
+			_, err := newBackend(name, backendOptions{}).run(buildProgram(t, source))
+
+			var tatuErr *debug.Error
+			if !errors.As(err, &tatuErr) {
+				t.Fatalf("expected a located error, got %v", err)
+			}
+
+			if tatuErr.Line != 4 || tatuErr.Msg != "`-` invalid type STRING" {
+				t.Errorf("expected the error of the callback at line 4, got %v", tatuErr)
+			}
+		})
+	}
+}
+
+func TestCallbackNil(t *testing.T) {
+	// a native calling back a nil function
+	callNil := func(env *runtime.Environment) {
+		env.DefineNative("call-nil", runtime.NewCallbackFunction(func(call runtime.Caller, args ...runtime.Value) (runtime.Value, error) {
+			return call(nil)
+		}))
+	}
+
+	modules := append(profile.Full(), callNil)
+
+	for _, name := range backendNames {
+		_, err := newBackend(name, sandboxed(modules)).run(buildProgram(t, "(call-nil)"))
+		if err == nil || !strings.HasSuffix(err.Error(), "cannot call nil: value is not a function") {
+			t.Errorf("%s: expected a nil call error, got %v", name, err)
+		}
+	}
+}
+
+func TestNestedCalls(t *testing.T) {
+	const source = `
+(def double (x) (* x 2))
+(+ 1 (host 20))
+`
+
+	// a registered Go function calling back the script keeps the state of the running evaluation
+	withHost := func(t *testing.T, b *backend) *backend {
+		err := b.Register("host", func(n float64) (runtime.Value, error) {
+			return b.CallGlobal("double", runtime.NewNumber(n))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return b
+	}
+
+	for _, name := range backendNames {
+		backend := withHost(t, newBackend(name, limits{steps: 1000}.options()))
+
+		if result, err := backend.run(buildProgram(t, source)); err != nil || result.String() != "41" {
+			t.Errorf("%s: expected 41, got %v, %v", name, result, err)
+		}
+
+		// the nested calls share the step limit of the outer evaluation
+		limited := withHost(t, newBackend(name, limits{steps: 10}.options()))
+
+		if _, err := limited.run(buildProgram(t, "(def double (x) (* x 2)) (host 1) (host 2) (host 3)")); err == nil {
+			t.Errorf("%s: expected the nested calls to count toward the step limit", name)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+type address struct {
+	Street string `tatu:"street-name"`
+	Number int    `tatu:",omitempty"`
+}
+
+type account struct {
+	ID        int                 `tatu:"id"`
+	Tags      []string            `tatu:"tags,omitempty"`
+	Addresses []address           `tatu:"addresses"`
+	Scores    map[string][]int    `tatu:"scores"`
+	Extra     map[string]any      `tatu:"extra"`
+	Parent    *account            `tatu:"parent"`
+	Password  string              `tatu:"-"`
+	Nested    [][]float64         `tatu:"nested"`
+	Labels    map[string]*address `tatu:"labels"`
+}
+
+type node struct {
+	Next *node
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  any
+		expect string
+	}{
+		{"nil", nil, "<nil>"},
+		{"number", 42, "42"},
+		{"unsigned", uint8(7), "7"},
+		{"string", "tatu", "tatu"},
+		{"bool", true, "true"},
+		{"nil slice", []int(nil), "<nil>"},
+		{"array", [2]string{"a", "b"}, "(a b)"},
+		{"nested slices", [][]int{{1, 2}, {3}}, "((1 2) (3))"},
+		{"tags", address{Street: "Main"}, "street-name"},
+		{"omitempty", address{Street: "Main"}, "!number"},
+		{"omitempty set", address{Street: "Main", Number: 3}, "number"},
+		{"skipped field", account{Password: "secret"}, "!secret"},
+		{"value", runtime.NewString("kept"), "kept"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := runtime.FromGo(tt.value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			m, isMap := value.(runtime.Map)
+
+			switch {
+			case isMap && strings.HasPrefix(tt.expect, "!"):
+				if _, ok := m.Elements[tt.expect[1:]]; ok {
+					t.Errorf("expected no key %q in %s", tt.expect[1:], value)
+				}
+			case isMap:
+				if _, ok := m.Elements[tt.expect]; !ok {
+					t.Errorf("expected key %q in %s", tt.expect, value)
+				}
+			case value.String() != tt.expect:
+				t.Errorf("expected %q, got %q", tt.expect, value.String())
+			}
+		})
+	}
+}
+
+func TestFromGoErrors(t *testing.T) {
+	cycle := &node{}
+	cycle.Next = cycle
+
+	tests := []struct {
+		name   string
+		value  any
+		expect string
+	}{
+		{"channel", make(chan int), "unsupported type chan int"},
+		{"map key", map[int]string{1: "a"}, "unsupported map key type int"},
+		{"nested function", []any{func() {}}, "unsupported type func()"},
+		{"cycle", cycle, "exceeded 1000 nested values"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runtime.FromGo(tt.value)
+			if err == nil || !strings.Contains(err.Error(), tt.expect) {
+				t.Errorf("expected error containing %q, got %v", tt.expect, err)
+			}
+		})
+	}
+}
+
+func TestConversionRoundTrip(t *testing.T) {
+	original := account{
+		ID:        7,
+		Tags:      []string{"admin"},
+		Addresses: []address{{Street: "Main", Number: 12}, {Street: "Side"}},
+		Scores:    map[string][]int{"math": {9, 10}},
+		Extra:     map[string]any{"active": true, "ratio": 0.5, "notes": []any{"a", nil}},
+		Parent:    &account{ID: 1, Scores: map[string][]int{}, Extra: map[string]any{}},
+		Password:  "secret",
+		Nested:    [][]float64{{1.5}, {}},
+		Labels:    map[string]*address{"home": {Street: "Main"}, "none": nil},
+	}
+
+	value, err := runtime.FromGo(original)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var converted account
+	if err = runtime.ToGo(value, &converted); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	original.Password = ""
+
+	if !reflect.DeepEqual(original, converted) {
+		t.Errorf("expected %+v, got %+v", original, converted)
+	}
+}
+
+func TestToGoNative(t *testing.T) {
+	value := runtime.NewMap(map[string]runtime.Value{
+		"list": runtime.NewVector([]runtime.Value{runtime.NewNumber(1), runtime.NewNil()}),
+		"name": runtime.NewString("tatu"),
+	})
+
+	var converted any
+	if err := runtime.ToGo(value, &converted); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expect := map[string]any{"list": []any{1.0, nil}, "name": "tatu"}
+
+	if !reflect.DeepEqual(expect, converted) {
+		t.Errorf("expected %#v, got %#v", expect, converted)
+	}
+}
+
+func TestToGoErrors(t *testing.T) {
+	nums := func(values ...float64) runtime.Value {
+		elements := make([]runtime.Value, len(values))
+
+		for idx, v := range values {
+			elements[idx] = runtime.NewNumber(v)
+		}
+
+		return runtime.NewVector(elements)
+	}
+
+	tests := []struct {
+		name   string
+		value  runtime.Value
+		target any
+		expect string
+	}{
+		{"not a pointer", runtime.NewNumber(1), 0, "cannot convert to int: expected a non-nil pointer"},
+		{"mismatch", runtime.NewString("a"), new(float64), "expected NUMBER, got STRING"},
+		{"fraction", runtime.NewNumber(1.5), new(int), "expected integer NUMBER in range of int, got 1.5"},
+		{"range", runtime.NewNumber(300), new(uint8), "expected integer NUMBER in range of uint8, got 300"},
+		{"array length", nums(1, 2), new([3]int), "expected VECTOR of 3 elements, got 2 elements"},
+		{"nested element", nums(1, 2.5), new([]int), "expected integer NUMBER in range of int at [1], got 2.5"},
+		{
+			"nested field",
+			runtime.NewMap(map[string]runtime.Value{"addresses": runtime.NewVector([]runtime.Value{
+				runtime.NewMap(map[string]runtime.Value{"street-name": runtime.NewNumber(1)}),
+			})}),
+			new(account),
+			"expected STRING at .addresses[0].street-name, got NUMBER",
+		},
+		{
+			"nested key",
+			runtime.NewMap(map[string]runtime.Value{"math": runtime.NewString("a")}),
+			new(map[string][]int),
+			`expected VECTOR at ["math"], got STRING`,
+		},
+		{"function", runtime.NewNativeFunction(nil), new(any), "expected NIL, BOOL, NUMBER, STRING, VECTOR or MAP, got NATIVE_FUNC"},
+		{"unsupported target", runtime.NewNumber(1), new(chan int), "unsupported type chan int"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runtime.ToGo(tt.value, tt.target)
+			if err == nil || err.Error() != tt.expect {
+				t.Errorf("expected error %q, got %v", tt.expect, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package test
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/cst"
+	"github.com/danielspk/tatu-lang/pkg/scanner"
+	"github.com/danielspk/tatu-lang/pkg/token"
+)
+
+func TestCSTRoundTrip(t *testing.T) {
+	sources := map[string]string{
+		"empty":               "",
+		"only trivia":         "  \t\n; comment\n\n",
+		"no final newline":    "(+ 1 2) ; sum",
+		"crlf":                "; header\r\n(def f (x)\r\n  (* x 2))\r\n\r\n(f 2)\r\n",
+		"lone carriage":       "(a\rb)\r",
+		"strings":             "(str:concat \"a\\n\\\"b\\\"\" \"multi\nline\" \"ñandú\")\n",
+		"nested and ellipsis": "(macro m (x ...) (block x ...))\n\t(m  1\t2)  ;x\n",
+	}
+
+	for _, file := range findTestFiles(t) {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sources[file] = string(source)
+	}
+
+	for name, source := range sources {
+		tokens, err := scanner.NewScanner(scanner.WithTrivia()).Scan([]byte(source), name)
+		if err != nil {
+			// error tests with invalid tokens
+			continue
+		}
+
+		tree, err := cst.NewParser().Parse(tokens)
+		if err != nil {
+			// error tests with unbalanced parens
+			continue
+		}
+
+		if output := tree.String(); output != source {
+			t.Errorf("%s: expected the source back, got:\n%q\ninstead of:\n%q", name, output, source)
+		}
+	}
+}
+
+func TestScannerTrivia(t *testing.T) {
+	const source = "; doc\n(a  b) ; end\n\n"
+
+	tokens, err := scanner.NewScanner(scanner.WithTrivia()).Scan([]byte(source), "trivia.tatu")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type trivia struct {
+		kind token.TriviaKind
+		text string
+	}
+
+	texts := func(list []token.Trivia) []trivia {
+		var out []trivia
+
+		for _, t := range list {
+			out = append(out, trivia{t.Kind, t.Text})
+		}
+
+		return out
+	}
+
+	tests := []struct {
+		lexeme   string
+		leading  []trivia
+		trailing []trivia
+	}{
+		{"(", []trivia{{token.CommentTrivia, "; doc"}, {token.NewlineTrivia, "\n"}}, nil},
+		{"a", nil, []trivia{{token.WhitespaceTrivia, "  "}}},
+		{"b", nil, nil},
+		{")", nil, []trivia{{token.WhitespaceTrivia, " "}, {token.CommentTrivia, "; end"}, {token.NewlineTrivia, "\n"}}},
+		{"", []trivia{{token.NewlineTrivia, "\n"}}, nil},
+	}
+
+	if len(tokens) != len(tests) {
+		t.Fatalf("expected %d tokens, got %d", len(tests), len(tokens))
+	}
+
+	for i, tt := range tests {
+		tok := tokens[i]
+
+		if tok.Lexeme != tt.lexeme || !slices.Equal(texts(tok.Leading), tt.leading) || !slices.Equal(texts(tok.Trailing), tt.trailing) {
+			t.Errorf("token %d: expected %q with %v and %v, got %q with %v and %v",
+				i, tt.lexeme, tt.leading, tt.trailing, tok.Lexeme, texts(tok.Leading), texts(tok.Trailing))
+		}
+	}
+
+	if comment := tokens[3].Trailing[1]; comment.Start.Line != 2 || comment.Start.Column != 8 {
+		t.Errorf("expected the comment at 2:8, got %d:%d", comment.Start.Line, comment.Start.Column)
+	}
+
+	// without the option, the tokens are the same with no trivia
+	plain, err := scanner.NewScanner().Scan([]byte(source), "trivia.tatu")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, tok := range plain {
+		if tok.Lexeme != tokens[i].Lexeme || tok.Location != tokens[i].Location || tok.Leading != nil || tok.Trailing != nil {
+			t.Errorf("token %d: expected %q at %v without trivia, got %+v", i, tokens[i].Lexeme, tokens[i].Location, tok)
+		}
+	}
+}
+
+func TestCSTNodes(t *testing.T) {
+	const source = `; Adds two numbers.
+; Returns a number.
+(def add (a b)
+  (+ a b)) ; trailing
+
+; Unrelated comment.
+
+(def twice (x) (add x x))
+   ; Indented doc.
+   (twice 2)
+`
+
+	tokens, err := scanner.NewScanner(scanner.WithTrivia()).Scan([]byte(source), "doc.tatu")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tree, err := cst.NewParser().Parse(tokens)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(tree.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got %d", len(tree.Nodes))
+	}
+
+	docs := []string{"Adds two numbers.\nReturns a number.", "", "Indented doc."}
+
+	for i, node := range tree.Nodes {
+		if doc := cst.Doc(node); doc != docs[i] {
+			t.Errorf("node %d: expected doc %q, got %q", i, docs[i], doc)
+		}
+	}
+
+	def := tree.Nodes[0].(*cst.List)
+	body := def.Nodes[3]
+
+	if body.String() != "  (+ a b)" {
+		t.Errorf("expected the source of the body with its trivia, got %q", body.String())
+	}
+
+	if loc := def.Location(); loc.Start.Line != 3 || loc.End.Line != 4 || loc.End.Column != 11 {
+		t.Errorf("expected the def from 3:1 to 4:11, got %v", loc)
+	}
+
+	if name := def.Nodes[1].(*cst.Atom); name.Token.Lexeme != "add" {
+		t.Errorf("expected the name `add`, got %q", name.Token.Lexeme)
+	}
+}
+
+func TestCSTErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{"(+ 1 2", "[Line 1][Column 2] Error: unclosed parenthesis"},
+		{"(+ 1 2))", "[Line 1][Column 9] Error: expected expression"},
+	}
+
+	for _, tt := range tests {
+		tokens, err := scanner.NewScanner(scanner.WithTrivia()).Scan([]byte(tt.input), "cst.tatu")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = cst.NewParser().Parse(tokens)
+		if err == nil || err.Error() != tt.expect {
+			t.Errorf("expected error %q for %q, got %v", tt.expect, tt.input, err)
+		}
+	}
+}
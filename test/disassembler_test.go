@@ -0,0 +1,76 @@
+package test
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/builder"
+	"github.com/danielspk/tatu-lang/pkg/pretty"
+	"github.com/danielspk/tatu-lang/pkg/vm"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// colors matches the ANSI color codes of the pretty output.
+var colors = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+const disassembledSource = `(def make-counter (start)
+  (block
+    (var count start)
+    (var reset (lambda () (lambda () (set count start))))
+    (lambda ()
+      (block
+        (set count (+ count 1))
+        count))))
+
+(var counter (make-counter 10))
+(counter)
+`
+
+// TestDisassembler checks the disassembly of nested functions, captured variables and constants with a wide index
+// against testdata/disassembly.golden. Run `go test -run TestDisassembler -update` to rewrite it.
+func TestDisassembler(t *testing.T) {
+	// enough constants for the last ones to need CONST_LONG
+	numbers := make([]string, 0, 260)
+
+	for n := range 260 {
+		numbers = append(numbers, fmt.Sprint(n))
+	}
+
+	source := disassembledSource + "(vector " + strings.Join(numbers, " ") + ")\n"
+
+	_, program, err := builder.NewProgramBuilderWithDefaults().BuildFromSource([]byte(source), "/disassembly.tatu")
+	if err != nil {
+		t.Fatalf("building source: %v", err)
+	}
+
+	compiler := vm.NewCompiler()
+
+	code, err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiling source: %v", err)
+	}
+
+	output := colors.ReplaceAllString(pretty.FormatBytecode(code), "")
+	golden := filepath.Join("testdata", "disassembly.golden")
+
+	if *update {
+		if err := os.WriteFile(golden, []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output != string(expect) {
+		t.Errorf("disassembly differs from %s:\n%s", golden, output)
+	}
+}
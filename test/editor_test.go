@@ -0,0 +1,147 @@
+package test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/repl"
+)
+
+func TestEditor(t *testing.T) {
+	completer := func(word string) []string {
+		var out []string
+
+		for _, name := range []string{"str:upper", "str:trim", "str:trim-left", "vec:map"} {
+			if strings.HasPrefix(name, word) {
+				out = append(out, name)
+			}
+		}
+
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		keys   string
+		expect []string
+	}{
+		{"plain lines", "(+ 1 2)\r\"a\"\n", []string{"(+ 1 2)", `"a"`}},
+		{"single completion", "(str:up\t \"a\")\r", []string{`(str:upper "a")`}},
+		{"common prefix", "(str:t\t\r", []string{"(str:trim"}},
+		{"no completion", "(zz\t)\r", []string{"(zz)"}},
+		{"backspace", "(+ 1 23\x7f)\r", []string{"(+ 1 2)"}},
+		{"move and insert", "(1 2)\x1b[D\x1b[D\x1b[D\x1b[D+ \r", []string{"(+ 1 2)"}},
+		{"modified arrow", "ab\x1b[1;5Dc\r", []string{"acb"}},
+		{"home and kill line", "x (+ 1 2)\x01\x0b(+ 3 4)\r", []string{"(+ 3 4)"}},
+		{"delete word", "(a bb  \x17c)\r", []string{"(a c)"}},
+		{"delete key", "ab\x1b[H\x1b[3~\r", []string{"b"}},
+		{"history", "one\rtwo\r\x1b[A\x1b[A\r", []string{"one", "two", "one"}},
+		{"history back to draft", "one\rdraft\x1b[A\x1b[B\r", []string{"one", "draft"}},
+		{"last line without newline", "end", []string{"end"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := repl.NewEditor(strings.NewReader(tt.keys), io.Discard, repl.WithCompleter(completer))
+
+			var lines []string
+
+			for {
+				line, err := editor.ReadLine("> ")
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				lines = append(lines, line)
+			}
+
+			if !slices.Equal(lines, tt.expect) {
+				t.Errorf("expected lines %q, got %q", tt.expect, lines)
+			}
+		})
+	}
+}
+
+func TestEditorControlKeys(t *testing.T) {
+	editor := repl.NewEditor(strings.NewReader("(+ 1\x03\x04"), io.Discard)
+
+	if _, err := editor.ReadLine("> "); !errors.Is(err, repl.ErrInterrupted) {
+		t.Errorf("expected Ctrl-C to interrupt the line, got %v", err)
+	}
+
+	if _, err := editor.ReadLine("> "); !errors.Is(err, io.EOF) {
+		t.Errorf("expected Ctrl-D to end the input, got %v", err)
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".tatu_history")
+
+	history, err := repl.LoadHistory(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	editor := repl.NewEditor(strings.NewReader("(var x 1)\r\r(var x 1)\r  \rx\r"), io.Discard, repl.WithHistory(history))
+
+	for range 5 {
+		if _, err := editor.ReadLine("> "); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	reloaded, err := repl.LoadHistory(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expect := []string{"(var x 1)", "x"}
+
+	if !slices.Equal(reloaded.Entries(), expect) {
+		t.Errorf("expected history %q, got %q", expect, reloaded.Entries())
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected a private history file, got %v, %v", info, err)
+	}
+
+	editor = repl.NewEditor(strings.NewReader("\x1b[A\x1b[A\r"), io.Discard, repl.WithHistory(reloaded))
+
+	if line, err := editor.ReadLine("> "); err != nil || line != "(var x 1)" {
+		t.Errorf("expected the previous session in the history, got %q, %v", line, err)
+	}
+}
+
+func TestREPLCompletion(t *testing.T) {
+	session := repl.NewREPL(io.Discard)
+	session.Eval("(def str:shout (s) (str:concat (str:upper s) \"!\"))\n(var lambda-count 0)\n")
+
+	tests := []struct {
+		prefix string
+		expect []string
+	}{
+		{"str:up", []string{"str:upper"}},
+		{"str:sh", []string{"str:shout"}},
+		{"lam", []string{"lambda", "lambda-count"}},
+		{"nope", nil},
+	}
+
+	for _, tt := range tests {
+		if completions := session.Complete(tt.prefix); !slices.Equal(completions, tt.expect) {
+			t.Errorf("expected completions of %q to be %q, got %q", tt.prefix, tt.expect, completions)
+		}
+	}
+
+	if completions := session.Complete("vec:"); !slices.Contains(completions, "vec:map") {
+		t.Errorf("expected the standard library in the completions, got %q", completions)
+	}
+}
@@ -8,15 +8,137 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/danielspk/tatu-lang/pkg/ast"
 	"github.com/danielspk/tatu-lang/pkg/builder"
-	"github.com/danielspk/tatu-lang/pkg/interpreter"
+	"github.com/danielspk/tatu-lang/pkg/debug"
 	"github.com/danielspk/tatu-lang/pkg/runtime"
+	"github.com/danielspk/tatu-lang/pkg/vm"
 )
 
 const expectPrefix = "; Expect: "
 const expectErrorPrefix = "; Expect Error: "
+const interpreterOnlyPrefix = "; Interpreter Only: "
+
+// evaluator evaluates a built program with one of the language backends.
+type evaluator func(program *ast.AST) (runtime.Value, error)
 
 func TestPrograms(t *testing.T) {
+	files := findTestFiles(t)
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Errorf("reading test file: %s", err)
+			}
+
+			err = runTestSource(content, file, evalInterpreted)
+			if err != nil {
+				t.Errorf("running test file: %s", err)
+			}
+		})
+	}
+}
+
+func TestProgramsCompiled(t *testing.T) {
+	runCompiledTests(t, evalCompiled)
+}
+
+func TestProgramsOptimized(t *testing.T) {
+	runCompiledTests(t, evalOptimized)
+}
+
+func TestProgramsSerialized(t *testing.T) {
+	runCompiledTests(t, evalSerialized)
+}
+
+// TestBackendParity checks that the interpreter and the virtual machine give the same result or error message.
+func TestBackendParity(t *testing.T) {
+	files := findTestFiles(t)
+	optedOut := 0
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("reading test file: %s", err)
+			}
+
+			if reason, ok := interpreterOnly(content); ok {
+				optedOut++
+				t.Skipf("interpreter only: %s", reason)
+			}
+
+			progBuilder := builder.NewProgramBuilderWithDefaults()
+			_, ast, err := progBuilder.BuildFromFile(file)
+			if err != nil {
+				t.Skipf("front end error: %s", err)
+			}
+
+			expected := outcome(evalInterpreted, ast)
+
+			for name, eval := range map[string]evaluator{"vm": evalCompiled, "vm optimized": evalOptimized} {
+				if actual := outcome(eval, ast); actual != expected {
+					t.Errorf("%s differs from the interpreter: expected `%s`, found `%s`", name, expected, actual)
+				}
+			}
+		})
+	}
+
+	t.Logf("%d of %d programs run on every backend", len(files)-optedOut, len(files))
+}
+
+// runCompiledTests runs the test programs on a virtual machine backend, skipping the interpreter only ones.
+func runCompiledTests(t *testing.T, eval evaluator) {
+	files := findTestFiles(t)
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Errorf("reading test file: %s", err)
+			}
+
+			if reason, ok := interpreterOnly(content); ok {
+				t.Skipf("interpreter only: %s", reason)
+			}
+
+			err = runTestSource(content, file, eval)
+			if err != nil {
+				t.Errorf("running test file: %s", err)
+			}
+		})
+	}
+}
+
+// interpreterOnly returns the reason of the `; Interpreter Only:` annotation of a test program.
+func interpreterOnly(source []byte) (string, bool) {
+	startIdx := strings.Index(string(source), interpreterOnlyPrefix)
+	if startIdx == -1 {
+		return "", false
+	}
+
+	reason, _, _ := strings.Cut(string(source[startIdx+len(interpreterOnlyPrefix):]), "\n")
+
+	return strings.TrimSpace(reason), true
+}
+
+// outcome evaluates a program and describes its result or its error message, without the error location.
+func outcome(eval evaluator, program *ast.AST) string {
+	value, err := eval(program)
+	if err != nil {
+		var tatuErr *debug.Error
+		if errors.As(err, &tatuErr) {
+			return "error: " + tatuErr.Msg
+		}
+
+		return "error: " + err.Error()
+	}
+
+	return value.String()
+}
+
+func findTestFiles(t *testing.T) []string {
 	var files []string
 
 	err := filepath.WalkDir("./", func(path string, d os.DirEntry, err error) error {
@@ -34,39 +156,69 @@ func TestPrograms(t *testing.T) {
 		t.Fatalf("exploring .tatu test files: %s", err)
 	}
 
-	for _, file := range files {
-		t.Run(file, func(t *testing.T) {
-			content, err := os.ReadFile(file)
-			if err != nil {
-				t.Errorf("reading test file: %s", err)
-			}
+	return files
+}
 
-			err = runTestSource(content, file)
-			if err != nil {
-				t.Errorf("running test file: %s", err)
-			}
-		})
+func evalInterpreted(program *ast.AST) (runtime.Value, error) {
+	return newBackend("interp", backendOptions{}).run(program)
+}
+
+func evalCompiled(program *ast.AST) (runtime.Value, error) {
+	return newBackend("vm", backendOptions{}).run(program)
+}
+
+func evalOptimized(program *ast.AST) (runtime.Value, error) {
+	compiler := vm.NewCompiler(vm.WithOptimizations())
+
+	code, err := compiler.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vm.Verify(code); err != nil {
+		return nil, err
+	}
+
+	return vm.NewVirtualMachine().Execute(code)
+}
+
+func evalSerialized(program *ast.AST) (runtime.Value, error) {
+	compiler := vm.NewCompiler()
+
+	code, err := compiler.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := vm.Marshal(vm.NewProgram([]*vm.Code{code}, nil))
+	if err != nil {
+		return nil, err
 	}
+
+	decoded, err := vm.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return vm.NewVirtualMachine().Execute(decoded.Codes[0])
 }
 
-func runTestSource(source []byte, filename string) error {
+func runTestSource(source []byte, filename string, eval evaluator) error {
 	if strings.Contains(string(source), expectErrorPrefix) {
-		return runErrorTest(source, filename)
+		return runErrorTest(source, filename, eval)
 	}
 
-	return runSuccessTest(source, filename)
+	return runSuccessTest(source, filename, eval)
 }
 
-func runSuccessTest(source []byte, filename string) error {
+func runSuccessTest(source []byte, filename string, eval evaluator) error {
 	progBuilder := builder.NewProgramBuilderWithDefaults()
 	_, ast, err := progBuilder.BuildFromFile(filename)
 	if err != nil {
 		return fmt.Errorf("building source: %w", err)
 	}
 
-	inter := interpreter.NewInterpreter()
-
-	lastValue, err := inter.EvalProgram(ast, nil)
+	lastValue, err := eval(ast)
 	if err != nil {
 		return fmt.Errorf("evaluating program: %w", err)
 	}
@@ -102,13 +254,11 @@ func runSuccessTest(source []byte, filename string) error {
 	return nil
 }
 
-func runErrorTest(source []byte, filename string) error {
+func runErrorTest(source []byte, filename string, eval evaluator) error {
 	progBuilder := builder.NewProgramBuilderWithDefaults()
 	_, ast, evalError := progBuilder.BuildFromFile(filename)
 	if evalError == nil {
-		inter := interpreter.NewInterpreter()
-
-		_, evalError = inter.EvalProgram(ast, nil)
+		_, evalError = eval(ast)
 	}
 
 	if evalError == nil {
@@ -0,0 +1,164 @@
+package test
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/formatter"
+	"github.com/danielspk/tatu-lang/pkg/scanner"
+	"github.com/danielspk/tatu-lang/pkg/token"
+)
+
+func TestFormatter(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{"spacing", "(  +   1\t2 )", "(+ 1 2)\n"},
+		{"one expression per line", "(var x 1) (var y 2)\n\n\n\nx", "(var x 1)\n(var y 2)\n\nx\n"},
+		{"atoms as written", "(+ 1.50 -0 \"a\\n\\\"b\\\"\")", "(+ 1.50 -0 \"a\\n\\\"b\\\"\")\n"},
+		{"multi-line string", "(print \"a\n  b\")", "(print \"a\n  b\")\n"},
+		{"def", "(def add (a b)\n(+ a b))", "(def add (a b)\n  (+ a b))\n"},
+		{"def in a line", "(def add (a b) (+ a b))", "(def add (a b) (+ a b))\n"},
+		{"if", "(if (> x 1) \"big\"\n      \"small\")", "(if (> x 1)\n  \"big\"\n  \"small\")\n"},
+		{"dangling parens", "(block\n  (set x 1)\n  x\n)\n", "(block\n  (set x 1)\n  x)\n"},
+		{
+			"switch",
+			"(switch\n ((= x 1) \"one\")\n   (default \"other\"))",
+			"(switch ((= x 1) \"one\")\n        (default \"other\"))\n",
+		},
+		{
+			"for",
+			"(for (var i 0)\n (< i 3)\n (set i (+ i 1))\n (print i))",
+			"(for (var i 0) (< i 3) (set i (+ i 1))\n  (print i))\n",
+		},
+		{
+			"macro",
+			"(macro unless (c body)\n(if c nil body))",
+			"(macro unless (c body)\n  (if c nil body))\n",
+		},
+		{
+			"var keeps the value line",
+			"(var inc (lambda (x)\n(+ x 1)))\n(var y\n(inc 1))",
+			"(var inc (lambda (x)\n  (+ x 1)))\n(var y\n  (inc 1))\n",
+		},
+		{
+			"call keeps the lines",
+			"(vector 1 2 3\n 4 5 6)\n(vec:map (vector 1 2)\n(lambda (x)\n(* x 2)))",
+			"(vector 1 2 3\n  4 5 6)\n(vec:map (vector 1 2)\n  (lambda (x)\n    (* x 2)))\n",
+		},
+		{
+			"long line",
+			"(str:concat \"aaaaaaaaaaaaaaaaaaaaaaaaa\" \"bbbbbbbbbbbbbbbbbbbbbbbbb\" \"ccccccccccccccccccccccccc\")",
+			"(str:concat\n  \"aaaaaaaaaaaaaaaaaaaaaaaaa\"\n  \"bbbbbbbbbbbbbbbbbbbbbbbbb\"\n  \"ccccccccccccccccccccccccc\")\n",
+		},
+		{
+			"long map",
+			"(var m (map \"first-key\" \"first value\" \"second-key\" \"second value\" \"third-key\" 3 \"fourth-key\" 4))",
+			"(var m\n  (map\n    \"first-key\" \"first value\"\n    \"second-key\" \"second value\"\n    \"third-key\" 3\n    \"fourth-key\" 4))\n",
+		},
+		{
+			"comments",
+			"; header\n\n(def f (x) ; doc\n ; body\n (block\n  (print x) ; trailing\n\n\n  x)) ; end\n; footer",
+			"; header\n\n(def f (x) ; doc\n  ; body\n  (block\n    (print x) ; trailing\n\n    x)) ; end\n; footer\n",
+		},
+		{"comment before closing paren", "(block\n  x ; last\n)", "(block\n  x ; last\n  )\n"},
+		{"comment keeps trailing spaces", "; Expect: \n", "; Expect: \n"},
+		{"only comments", "; a\r\n\r\n; b\r\n", "; a\n\n; b\n"},
+		{"empty", "\n\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := formatter.NewFormatter().Format([]byte(tt.input), "format.tatu")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if string(output) != tt.expect {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expect, output)
+			}
+		})
+	}
+}
+
+func TestFormatterErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{"(+ 1 2", "[Line 1][Column 2] Error: unclosed parenthesis"},
+		{"\"open", "[Line 1][Column 6] Error: unterminated string"},
+		{")", "[Line 1][Column 2] Error: expected expression"},
+	}
+
+	for _, tt := range tests {
+		_, err := formatter.NewFormatter().Format([]byte(tt.input), "format.tatu")
+		if err == nil || err.Error() != tt.expect {
+			t.Errorf("expected error %q for %q, got %v", tt.expect, tt.input, err)
+		}
+	}
+}
+
+func TestFormatterWidth(t *testing.T) {
+	output, err := formatter.NewFormatter(formatter.WithLineWidth(12)).Format([]byte("(if (> x 1) 1 2)"), "format.tatu")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expect := "(if (> x 1)\n  1\n  2)\n"; string(output) != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, output)
+	}
+}
+
+// TestFormatterCorpus formats the test files, checking that the tokens and the comments are kept and that
+// formatting again changes nothing.
+func TestFormatterCorpus(t *testing.T) {
+	sourceFormatter := formatter.NewFormatter()
+
+	for _, file := range findTestFiles(t) {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := sourceFormatter.Format(source, file)
+		if err != nil {
+			// error tests with invalid syntax
+			continue
+		}
+
+		if !slices.Equal(lexemes(t, source), lexemes(t, output)) {
+			t.Errorf("%s: formatting changed the tokens:\n%s", file, output)
+		}
+
+		again, err := sourceFormatter.Format(output, file)
+		if err != nil || string(again) != string(output) {
+			t.Errorf("%s: formatting is not stable:\n%s\nthen:\n%s", file, output, again)
+		}
+	}
+}
+
+// lexemes returns the lexemes of the tokens and the comments of a source.
+func lexemes(t *testing.T, source []byte) []string {
+	tokens, err := scanner.NewScanner(scanner.WithTrivia()).Scan(source, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out []string
+
+	for _, tok := range tokens {
+		for _, trivia := range slices.Concat(tok.Leading, tok.Trailing) {
+			if trivia.Kind == token.CommentTrivia {
+				out = append(out, trivia.Text)
+			}
+		}
+
+		out = append(out, tok.Lexeme)
+	}
+
+	return out
+}
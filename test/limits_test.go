@@ -0,0 +1,201 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danielspk/tatu-lang/pkg/ast"
+	"github.com/danielspk/tatu-lang/pkg/builder"
+	"github.com/danielspk/tatu-lang/pkg/debug"
+	"github.com/danielspk/tatu-lang/pkg/interpreter"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+	"github.com/danielspk/tatu-lang/pkg/vm"
+)
+
+const runawayLoop = `
+(var i 0)
+(while true (set i (+ i 1)))
+`
+
+const runawayRecur = `
+(def loop (n) (recur (+ n 1)))
+(loop 0)
+`
+
+// limits holds the execution limits of an evaluation.
+type limits struct {
+	steps   int
+	timeout time.Duration
+	memory  runtime.MemoryLimits
+}
+
+// options returns the options of the language backends enforcing the limits.
+func (l limits) options() backendOptions {
+	return backendOptions{
+		interpreter: []interpreter.Option{
+			interpreter.WithStepLimit(l.steps),
+			interpreter.WithTimeout(l.timeout),
+			interpreter.WithMemoryLimits(l.memory),
+		},
+		vm: []vm.Option{
+			vm.WithStepLimit(l.steps),
+			vm.WithTimeout(l.timeout),
+			vm.WithMemoryLimits(l.memory),
+		},
+	}
+}
+
+// evalLimited evaluates a program with execution limits on a language backend.
+func evalLimited(ctx context.Context, name string, program *ast.AST, limits limits) error {
+	_, err := newBackend(name, limits.options()).eval(ctx, program)
+
+	return err
+}
+
+func TestExecutionLimits(t *testing.T) {
+	for _, name := range backendNames {
+		t.Run(name+"/step budget", func(t *testing.T) {
+			err := evalLimited(context.Background(), name, buildProgram(t, runawayLoop), limits{steps: 10000})
+			expectLimit(t, err, debug.StepLimit)
+		})
+
+		t.Run(name+"/timeout", func(t *testing.T) {
+			err := evalLimited(context.Background(), name, buildProgram(t, runawayRecur), limits{timeout: 50 * time.Millisecond})
+			expectLimit(t, err, debug.DeadlineLimit)
+
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected the error to wrap context.DeadlineExceeded, found: %v", err)
+			}
+		})
+
+		t.Run(name+"/cancellation", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			err := evalLimited(ctx, name, buildProgram(t, runawayLoop), limits{})
+			expectLimit(t, err, debug.CancelLimit)
+		})
+
+		t.Run(name+"/step budget in callback", func(t *testing.T) {
+			source := `(vec:map (vector 1 2) (lambda (x) (while true x)))`
+
+			err := evalLimited(context.Background(), name, buildProgram(t, source), limits{steps: 10000})
+			expectLimit(t, err, debug.StepLimit)
+		})
+
+		t.Run(name+"/within limits", func(t *testing.T) {
+			err := evalLimited(context.Background(), name, buildProgram(t, "(+ 1 2)"), limits{steps: 100, timeout: time.Second})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMemoryLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		memory runtime.MemoryLimits
+	}{
+		{"string length", `(str:repeat "ab" 100)`, runtime.MemoryLimits{MaxStringLength: 64}},
+		{"string concatenation", `(var s "x") (while true (set s (+ s s)))`, runtime.MemoryLimits{MaxStringLength: 1024}},
+		{"string concat function", `(str:concat "abc" "def" "g")`, runtime.MemoryLimits{MaxStringLength: 6}},
+		{"string join", `(str:join (vector "abc" "def") "-")`, runtime.MemoryLimits{MaxStringLength: 6}},
+		{"vector push", `(var v (vector)) (while true (vec:push v 1))`, runtime.MemoryLimits{MaxCollectionSize: 100}},
+		{"vector literal", `(vector 1 2 3)`, runtime.MemoryLimits{MaxCollectionSize: 2}},
+		{"map literal", `(map "a" 1 "b" 2 "c" 3)`, runtime.MemoryLimits{MaxCollectionSize: 2}},
+		{"map set", `(var m (map)) (var i 0) (while true (block (map:set m (to-string i) i) (set i (+ i 1))))`, runtime.MemoryLimits{MaxCollectionSize: 100}},
+		{"vector map", `(vec:map (vector 1 2 3) (lambda (x) x))`, runtime.MemoryLimits{MaxCollectionSize: 2}},
+		{"callback allocation", `(vec:map (vector 1 2) (lambda (x) (str:repeat "x" 100)))`, runtime.MemoryLimits{MaxStringLength: 64}},
+		{"json decoded string", `(json:decode "[\"abcdefgh\"]")`, runtime.MemoryLimits{MaxStringLength: 4}},
+		{"json decoded collection", `(json:decode "{\"a\": [1, 2, 3]}")`, runtime.MemoryLimits{MaxCollectionSize: 2}},
+		{"json decoded allocation", `(json:decode "[1, 2, 3]")`, runtime.MemoryLimits{MaxAllocation: 40}},
+		{"total allocation", `(while true (str:repeat "x" 100))`, runtime.MemoryLimits{MaxAllocation: 10000}},
+	}
+
+	for _, name := range backendNames {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				err := evalLimited(context.Background(), name, buildProgram(t, tt.source), limits{memory: tt.memory})
+				expectLimit(t, err, debug.MemoryLimit)
+			})
+		}
+
+		t.Run(name+"/within limits", func(t *testing.T) {
+			memory := runtime.MemoryLimits{MaxStringLength: 16, MaxCollectionSize: 4, MaxAllocation: 1000}
+
+			err := evalLimited(context.Background(), name, buildProgram(t, `(vec:push (vector 1 2) (str:repeat "ab" 8))`), limits{memory: memory})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestStackLimits checks that the stack limits of the virtual machine stop a program with a located error.
+func TestStackLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		opts   []vm.Option
+		expect string
+	}{
+		{"call depth", "(def count (n)\n  (+ 1 (count (+ n 1))))\n(count 0)", []vm.Option{vm.WithCallDepth(50)}, "stack overflow: exceeded 50 nested calls"},
+		{"operand stack", "(var n 1)\n(vector n n n n n n n n n n n n n n n n)", []vm.Option{vm.WithStackSize(8)}, "stack overflow: exceeded 8 values"},
+		{"operands of nested calls", "(def add (a b) (+ a b))\n(add 1 (add 2 (add 3 (add 4 (add 5 6)))))", []vm.Option{vm.WithStackSize(8)}, "stack overflow: exceeded 8 values"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newBackend("vm", backendOptions{vm: tt.opts}).run(buildProgram(t, tt.source))
+
+			var tatuErr *debug.Error
+			if !errors.As(err, &tatuErr) || tatuErr.Msg != tt.expect {
+				t.Fatalf("expected error %q, found: %v", tt.expect, err)
+			}
+
+			if tatuErr.Line != 2 {
+				t.Errorf("expected the error located in line 2, found: %v", tatuErr)
+			}
+		})
+	}
+
+	t.Run("within limits", func(t *testing.T) {
+		machine := newBackend("vm", backendOptions{vm: []vm.Option{vm.WithCallDepth(50), vm.WithStackSize(256)}})
+
+		result, err := machine.run(buildProgram(t, "(def count (n) (if (= n 0) 0 (+ 1 (count (- n 1)))))\n(count 40)"))
+		if err != nil || result.String() != "40" {
+			t.Errorf("expected 40, found %v (error: %v)", result, err)
+		}
+	})
+}
+
+func buildProgram(t *testing.T, source string) *ast.AST {
+	progBuilder := builder.NewProgramBuilderWithDefaults()
+
+	_, program, err := progBuilder.BuildFromSource([]byte(source), "limits.tatu")
+	if err != nil {
+		t.Fatalf("building source: %v", err)
+	}
+
+	return program
+}
+
+func expectLimit(t *testing.T, err error, limit debug.Limit) {
+	var limitErr *debug.LimitError
+
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected a limit error, found: %v", err)
+	}
+
+	if limitErr.Limit != limit {
+		t.Errorf("expected limit %d, found %d: %s", limit, limitErr.Limit, limitErr.Msg)
+	}
+
+	if limitErr.Line == 0 {
+		t.Errorf("expected a located limit error, found: %v", limitErr)
+	}
+}
@@ -0,0 +1,433 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielspk/tatu-lang/pkg/lsp"
+)
+
+// lspMessage represents a message of the server: a response or a notification.
+type lspMessage struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// lspRange represents a range of the protocol.
+type lspRange struct {
+	Start struct{ Line, Character int } `json:"start"`
+	End   struct{ Line, Character int } `json:"end"`
+}
+
+// String shows the range as `line:character-line:character`.
+func (r lspRange) String() string {
+	return fmt.Sprintf("%d:%d-%d:%d", r.Start.Line, r.Start.Character, r.End.Line, r.End.Character)
+}
+
+// lspClient is a local JSON-RPC client of a server running on pipes.
+type lspClient struct {
+	t        *testing.T
+	in       io.WriteCloser
+	messages chan lspMessage
+	pending  []lspMessage // notifications received while waiting for a response
+	done     chan error
+	id       int
+}
+
+func newLSPClient(t *testing.T) *lspClient {
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+
+	c := &lspClient{t: t, in: inWriter, messages: make(chan lspMessage, 100), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- lsp.NewServer(inReader, outWriter).Run()
+		_ = outWriter.Close()
+	}()
+
+	go func() {
+		reader := textproto.NewReader(bufio.NewReader(outReader))
+
+		for {
+			header, err := reader.ReadMIMEHeader()
+			if err != nil {
+				close(c.messages)
+				return
+			}
+
+			length, _ := strconv.Atoi(header.Get("Content-Length"))
+			content := make([]byte, length)
+
+			if _, err := io.ReadFull(reader.R, content); err != nil {
+				close(c.messages)
+				return
+			}
+
+			var msg lspMessage
+			if err := json.Unmarshal(content, &msg); err != nil {
+				t.Errorf("invalid message %s: %v", content, err)
+			}
+
+			c.messages <- msg
+		}
+	}()
+
+	t.Cleanup(func() { _ = inWriter.Close() })
+
+	return c
+}
+
+// send writes a message to the server.
+func (c *lspClient) send(msg map[string]any) {
+	msg["jsonrpc"] = "2.0"
+
+	content, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// next returns the next message of the server.
+func (c *lspClient) next() lspMessage {
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("connection closed")
+		}
+
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timeout waiting for the server")
+	}
+
+	return lspMessage{}
+}
+
+// notify sends a notification.
+func (c *lspClient) notify(method string, params any) {
+	c.send(map[string]any{"method": method, "params": params})
+}
+
+// request sends a request and returns its response.
+func (c *lspClient) request(method string, params any) lspMessage {
+	c.id++
+	c.send(map[string]any{"id": c.id, "method": method, "params": params})
+
+	for {
+		msg := c.next()
+
+		if msg.ID != nil && *msg.ID == c.id {
+			return msg
+		}
+
+		c.pending = append(c.pending, msg)
+	}
+}
+
+// call sends a request and decodes its result.
+func (c *lspClient) call(method string, params any, result any) {
+	msg := c.request(method, params)
+
+	if msg.Error != nil {
+		c.t.Fatalf("%s: unexpected error %d: %s", method, msg.Error.Code, msg.Error.Message)
+	}
+
+	if err := json.Unmarshal(msg.Result, result); err != nil {
+		c.t.Fatalf("%s: invalid result %s: %v", method, msg.Result, err)
+	}
+}
+
+// diagnostics returns the next diagnostics published for a document.
+func (c *lspClient) diagnostics(uri string) []struct {
+	Range   lspRange `json:"range"`
+	Message string   `json:"message"`
+} {
+	for {
+		var msg lspMessage
+
+		if len(c.pending) > 0 {
+			msg, c.pending = c.pending[0], c.pending[1:]
+		} else {
+			msg = c.next()
+		}
+
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+
+		var params struct {
+			URI         string `json:"uri"`
+			Diagnostics []struct {
+				Range   lspRange `json:"range"`
+				Message string   `json:"message"`
+			} `json:"diagnostics"`
+		}
+
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			c.t.Fatal(err)
+		}
+
+		if params.URI == uri {
+			return params.Diagnostics
+		}
+	}
+}
+
+// position builds the params of a request at a position of a document.
+func position(uri string, line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+func TestLSP(t *testing.T) {
+	dir := t.TempDir()
+
+	lib := filepath.Join(dir, "lib.tatu")
+	main := filepath.Join(dir, "main.tatu")
+
+	if err := os.WriteFile(lib, []byte("; Adds two numbers.\n(def add (a b)\n  (+ a b))\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	libURI, mainURI := fileURI(lib), fileURI(main)
+
+	const source = `(include "lib.tatu")
+(var total (add 1 2))
+(print "ñandú" (str:len "x") total)
+(def twice (x)
+  (* x 2))
+`
+
+	c := newLSPClient(t)
+
+	if msg := c.request("textDocument/hover", position(mainURI, 0, 0)); msg.Error == nil || msg.Error.Code != -32002 {
+		t.Errorf("expected a not initialized error, got %+v", msg)
+	}
+
+	var initialize struct {
+		Capabilities struct {
+			TextDocumentSync   int  `json:"textDocumentSync"`
+			DefinitionProvider bool `json:"definitionProvider"`
+			HoverProvider      bool `json:"hoverProvider"`
+		} `json:"capabilities"`
+	}
+
+	c.call("initialize", map[string]any{}, &initialize)
+	c.notify("initialized", map[string]any{})
+
+	if caps := initialize.Capabilities; caps.TextDocumentSync != 1 || !caps.DefinitionProvider || !caps.HoverProvider {
+		t.Errorf("unexpected capabilities %+v", caps)
+	}
+
+	open := func(uri, text string) {
+		c.notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": "tatu", "version": 1, "text": text},
+		})
+	}
+
+	change := func(uri, text string) {
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []map[string]any{{"text": text}},
+		})
+	}
+
+	open(mainURI, source)
+
+	if diags := c.diagnostics(mainURI); len(diags) != 0 {
+		t.Fatalf("expected no diagnostics, got %+v", diags)
+	}
+
+	t.Run("definition", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			line, col int
+			uri       string
+			expect    string
+		}{
+			{"across an include", 1, 12, libURI, "1:5-1:8"},
+			{"global variable", 2, 32, mainURI, "1:5-1:10"},
+			{"parameter", 4, 6, mainURI, "3:12-3:13"},
+			{"definition name", 3, 6, mainURI, "3:5-3:10"},
+		}
+
+		for _, tt := range tests {
+			var location struct {
+				URI   string   `json:"uri"`
+				Range lspRange `json:"range"`
+			}
+
+			c.call("textDocument/definition", position(mainURI, tt.line, tt.col), &location)
+
+			if location.URI != tt.uri || location.Range.String() != tt.expect {
+				t.Errorf("%s: expected %s at %s, got %s at %s", tt.name, tt.uri, tt.expect, location.URI, location.Range)
+			}
+		}
+
+		// natives have no definition
+		if msg := c.request("textDocument/definition", position(mainURI, 2, 18)); string(msg.Result) != "null" {
+			t.Errorf("expected no definition for a native, got %s", msg.Result)
+		}
+	})
+
+	t.Run("hover", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			line, col int
+			expect    []string
+			rng       string
+		}{
+			// the columns count UTF-16 code units after the string with non-ASCII characters
+			{"native", 2, 18, []string{"(str:len s)", "Length"}, "2:16-2:23"},
+			{"included function", 1, 12, []string{"(def add (a b))", "Adds two numbers."}, "1:12-1:15"},
+			{"variable", 2, 32, []string{"(var total)"}, "2:29-2:34"},
+		}
+
+		for _, tt := range tests {
+			var hover struct {
+				Contents struct {
+					Kind  string `json:"kind"`
+					Value string `json:"value"`
+				} `json:"contents"`
+				Range lspRange `json:"range"`
+			}
+
+			c.call("textDocument/hover", position(mainURI, tt.line, tt.col), &hover)
+
+			for _, fragment := range tt.expect {
+				if !strings.Contains(hover.Contents.Value, fragment) {
+					t.Errorf("%s: expected %q in %q", tt.name, fragment, hover.Contents.Value)
+				}
+			}
+
+			if hover.Contents.Kind != "markdown" || hover.Range.String() != tt.rng {
+				t.Errorf("%s: expected markdown at %s, got %s at %s", tt.name, tt.rng, hover.Contents.Kind, hover.Range)
+			}
+		}
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		labels := func(line, col int) map[string]bool {
+			var items []struct {
+				Label string `json:"label"`
+			}
+
+			c.call("textDocument/completion", position(mainURI, line, col), &items)
+
+			found := make(map[string]bool)
+
+			for _, item := range items {
+				found[item.Label] = true
+			}
+
+			return found
+		}
+
+		body := labels(4, 5)
+
+		for _, label := range []string{"x", "twice", "total", "add", "str:len", "vec:map", "def", "lambda"} {
+			if !body[label] {
+				t.Errorf("expected %q in the completion of the body", label)
+			}
+		}
+
+		if outside := labels(2, 0); outside["x"] || outside["a"] {
+			t.Errorf("unexpected parameters in the completion of the top level")
+		}
+	})
+
+	t.Run("diagnostics", func(t *testing.T) {
+		change(mainURI, "(include \"lib.tatu\")\n(var total (add 1 2)\n")
+
+		diags := c.diagnostics(mainURI)
+		if len(diags) != 1 || diags[0].Message != "unclosed parenthesis" || diags[0].Range.String() != "1:0-1:1" {
+			t.Errorf("expected an unclosed parenthesis at 1:0-1:1, got %+v", diags)
+		}
+
+		// the bindings of the last well-formed text are kept while editing
+		var location struct {
+			URI string `json:"uri"`
+		}
+
+		c.call("textDocument/definition", position(mainURI, 1, 12), &location)
+
+		if location.URI != libURI {
+			t.Errorf("expected the definition in %s, got %q", libURI, location.URI)
+		}
+
+		change(mainURI, source)
+
+		if diags := c.diagnostics(mainURI); len(diags) != 0 {
+			t.Errorf("expected no diagnostics, got %+v", diags)
+		}
+
+		// an open document is built from its unsaved text
+		open(libURI, "(def add (a b)\n  (+ a b)\n")
+
+		if diags := c.diagnostics(libURI); len(diags) != 1 || diags[0].Range.String() != "0:0-0:1" {
+			t.Errorf("expected an unclosed parenthesis in the included file, got %+v", diags)
+		}
+
+		diags = c.diagnostics(mainURI)
+		if len(diags) != 1 || diags[0].Range.String() != "0:0-0:20" || !strings.Contains(diags[0].Message, "unclosed parenthesis") {
+			t.Errorf("expected the error of the included file on the include, got %+v", diags)
+		}
+
+		c.notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": libURI}})
+
+		if diags := c.diagnostics(libURI); len(diags) != 0 {
+			t.Errorf("expected the diagnostics of a closed document to be cleared, got %+v", diags)
+		}
+	})
+
+	if msg := c.request("workspace/symbol", map[string]any{}); msg.Error == nil || msg.Error.Code != -32601 {
+		t.Errorf("expected a method not found error, got %+v", msg)
+	}
+
+	if msg := c.request("shutdown", nil); msg.Error != nil || string(msg.Result) != "null" {
+		t.Errorf("expected a null shutdown result, got %+v", msg)
+	}
+
+	c.notify("exit", nil)
+
+	if err := <-c.done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLSPExitWithoutShutdown(t *testing.T) {
+	c := newLSPClient(t)
+
+	c.call("initialize", map[string]any{}, &struct{}{})
+	c.notify("exit", nil)
+
+	if err := <-c.done; err == nil {
+		t.Error("expected an error for an exit without a shutdown")
+	}
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/interpreter"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+)
+
+type user struct {
+	Name   string
+	Age    int
+	Emails []string
+	secret string
+}
+
+// hostFunctions are the Go functions registered by the tests.
+var hostFunctions = map[string]any{
+	"add":    func(a, b float64) float64 { return a + b },
+	"double": func(n int) int { return n * 2 },
+	"join":   func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+	"sum": func(values []float64) (total float64) {
+		for _, v := range values {
+			total += v
+		}
+
+		return total
+	},
+	"count":    func(m map[string]int) int { return len(m) },
+	"greet":    func(u user) string { return fmt.Sprintf("%s %d %d", u.Name, u.Age, len(u.Emails)) },
+	"new-user": func(name string) *user { return &user{Name: name, Age: 1, secret: "x"} },
+	"kind":     func(v any) string { return fmt.Sprintf("%T", v) },
+	"same":     func(v runtime.Value) runtime.Value { return v },
+	"nothing":  func() {},
+	"fail": func(msg string) (bool, error) {
+		if msg != "" {
+			return false, errors.New(msg)
+		}
+
+		return true, nil
+	},
+	"crash": func() int { panic("boom") },
+}
+
+func TestRegisterGoFunctions(t *testing.T) {
+	tests := []struct {
+		source string
+		expect string // expected value, or the expected error prefixed with "error: "
+	}{
+		{`(add 1 2)`, "3"},
+		{`(double 21)`, "42"},
+		{`(join "-" "a" "b" "c")`, "a-b-c"},
+		{`(join ",")`, ""},
+		{`(sum (vector 1 2 3.5))`, "6.5"},
+		{`(count (map "a" 1 "b" 2))`, "2"},
+		{`(greet (map "name" "Ann" "age" 30 "emails" (vector "a@b.c")))`, "Ann 30 1"},
+		{`(new-user "Bob")`, "[age 1 emails <nil> name Bob]"},
+		{`(vector (kind 1) (kind "s") (kind (vector 1)) (kind (map "a" 1)) (kind nil))`, "(float64 string []interface {} map[string]interface {} <nil>)"},
+		{`(same (vector 1 "a"))`, "(1 a)"},
+		{`(nothing)`, "<nil>"},
+		{`(fail "")`, "true"},
+		{`(add 1)`, "error: `add` expects 2 argument(s), got 1"},
+		{`(add 1 "2")`, "error: `add` expects NUMBER at argument 2, got STRING"},
+		{`(double 1.5)`, "error: `double` expects integer NUMBER in range of int at argument 1, got 1.5"},
+		{`(join)`, "error: `join` expects at least 1 argument(s), got 0"},
+		{`(join "-" "a" 1)`, "error: `join` expects STRING at argument 3, got NUMBER"},
+		{`(sum (vector 1 "2"))`, "error: `sum` expects NUMBER at argument 1[1], got STRING"},
+		{`(greet (map "name" 1))`, "error: `greet` expects STRING at argument 1.name, got NUMBER"},
+		{`(count (vector))`, "error: `count` expects MAP at argument 1, got VECTOR"},
+		{`(fail "host failure")`, "error: host failure"},
+		{`(crash)`, "error: `crash` panicked: boom"},
+	}
+
+	for _, name := range backendNames {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.source, func(t *testing.T) {
+				b := newBackend(name, backendOptions{})
+				registerHostFunctions(t, b)
+
+				result, err := b.run(buildProgram(t, tt.source))
+
+				expectedErr, isErr := strings.CutPrefix(tt.expect, "error: ")
+
+				switch {
+				case isErr && err == nil:
+					t.Errorf("expected error %q, found value %v", expectedErr, result)
+				case isErr && !strings.HasSuffix(err.Error(), "Error: "+expectedErr):
+					t.Errorf("expected error %q, found %q", expectedErr, err.Error())
+				case !isErr && err != nil:
+					t.Errorf("unexpected error: %v", err)
+				case !isErr && result.String() != tt.expect:
+					t.Errorf("expected %s, found %s", tt.expect, result.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRegisterInvalidGoFunctions(t *testing.T) {
+	tests := []struct {
+		name   string
+		fn     any
+		expect string
+	}{
+		{"not-a-function", 42, "cannot register `not-a-function`: expected a function, got int"},
+		{"channel", func(c chan int) {}, "cannot register `channel`: parameter 1: unsupported type chan int"},
+		{"int-keys", func(m map[int]string) {}, "cannot register `int-keys`: parameter 1: unsupported map key type int"},
+		{"two-results", func() (int, int) { return 0, 0 }, "cannot register `two-results`: expected at most one result and an error"},
+		{"+", func() {}, "cannot register `+`: symbol already defined"},
+	}
+
+	inter := interpreter.NewInterpreter()
+
+	for _, tt := range tests {
+		err := inter.Register(tt.name, tt.fn)
+		if err == nil || err.Error() != tt.expect {
+			t.Errorf("expected error %q, found %v", tt.expect, err)
+		}
+	}
+}
+
+func registerHostFunctions(t *testing.T, b host) {
+	for name, fn := range hostFunctions {
+		if err := b.Register(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
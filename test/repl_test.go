@@ -0,0 +1,63 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danielspk/tatu-lang/pkg/repl"
+)
+
+func TestREPL(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect []string // expected output fragments, in order
+		absent string   // unexpected output fragment
+	}{
+		{"expression", "(+ 1 2)\n", []string{"tatu> 3\n"}, ""},
+		{"state between inputs", "(var x 40)\n(+ x 2)\n", []string{"40\n", "42\n"}, ""},
+		{"multi-line form", "(def double (x)\n  (* x 2))\n(double 21)\n", []string{"....> ", "42\n"}, ""},
+		{"multi-line string", "\"a\nb\"\n", []string{"....> a\nb\n"}, ""},
+		{"several expressions", "1 2\n", []string{"1\n2\n"}, ""},
+		{"macros between inputs", "(macro unless (c body) (if c nil body))\n(unless false \"ran\")\n", []string{"ran\n"}, ""},
+		{"error keeps the session", "(missing)\n(+ 1 1)\n", []string{"unknown symbol `missing`", "2\n"}, ""},
+		{"error in earlier input", "(def f (x)\n  (- x \"a\"))\n(f 1)\n", []string{"file `<input 1>`", "(- x \"a\")", "invalid type STRING"}, ""},
+		{"extra closing paren", ")\n(+ 1 1)\n", []string{"expected expression", "2\n"}, ""},
+		{"env", "(var b 2)\n(var a 1)\n:env\n", []string{"a = 1\nb = 2\n"}, ""},
+		{"ast", ":ast (+ 1 2)\n", []string{"(Symbol +)", "(Number 2)"}, ""},
+		{"tokens", ":tokens (a)\n", []string{"LEFT_PAREN", "SYMBOL: `a`", "EOF"}, ""},
+		{"ast leaves macros undefined", ":ast (macro unless (c body) (if c nil body))\n(unless false 1)\n", []string{"unknown symbol `unless`"}, ""},
+		{"ast leaves the input count", ":ast 1\n(def f (x)\n  (- x \"a\"))\n(f 1)\n", []string{"file `<input 1>`"}, ""},
+		{"ast error", ":ast (+ 1\n", []string{"unclosed parenthesis"}, ""},
+		{"command usage", ":ast\n", []string{"usage: :ast <source>"}, ""},
+		{"unknown command", ":nope\n", []string{"unknown command `:nope`"}, ""},
+		{"help", ":help\n", []string{":env"}, ""},
+		{"quit", ":quit\n(+ 1 2)\n", []string{"tatu> "}, "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+
+			if err := repl.NewREPL(&out).Run(strings.NewReader(tt.input)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			output := out.String()
+			rest := output
+
+			for _, fragment := range tt.expect {
+				idx := strings.Index(rest, fragment)
+				if idx == -1 {
+					t.Fatalf("expected %q in the output:\n%s", fragment, output)
+				}
+
+				rest = rest[idx+len(fragment):]
+			}
+
+			if tt.absent != "" && strings.Contains(output, tt.absent) {
+				t.Errorf("unexpected %q in the output:\n%s", tt.absent, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/danielspk/tatu-lang/pkg/core/profile"
+	"github.com/danielspk/tatu-lang/pkg/core/stdlib"
+	"github.com/danielspk/tatu-lang/pkg/interpreter"
+	"github.com/danielspk/tatu-lang/pkg/runtime"
+	"github.com/danielspk/tatu-lang/pkg/vm"
+)
+
+// sandboxed returns the options of the language backends registering only the given modules.
+func sandboxed(modules []runtime.Module) backendOptions {
+	return backendOptions{
+		interpreter: []interpreter.Option{interpreter.WithModules(modules...)},
+		vm:          []vm.Option{vm.WithModules(modules...)},
+	}
+}
+
+func TestSandboxProfiles(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "data.txt"), []byte("a\nb"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(t.TempDir(), "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("/etc/hostname", filepath.Join(dir, "escape.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	mapFS := fstest.MapFS{"notes/todo.txt": {Data: []byte("write tests")}}
+
+	// built for each backend, so the file systems written by one do not affect the other
+	for _, name := range backendNames {
+		tests := []struct {
+			name    string
+			source  string
+			modules []runtime.Module
+			expect  string // expected value, or the expected error substring prefixed with "error: "
+		}{
+			{"pure allows the standard library", `(str:upper (+ "a" (to-string (math:abs -1))))`, profile.Pure(), "A1"},
+			{"pure denies the file system", `(fs:read "data.txt")`, profile.Pure(), "error: unknown symbol `fs:read`"},
+			{"pure denies deleting files", `(fs:delete "data.txt")`, profile.Pure(), "error: unknown symbol `fs:delete`"},
+			{"pure denies time", `(time:now)`, profile.Pure(), "error: unknown symbol `time:now`"},
+			{"pure denies random numbers", `(math:rand 1 10)`, profile.Pure(), "error: unknown symbol `math:rand`"},
+			{"read-only reads in the root", `(fs:read-lines "data.txt")`, profile.ReadOnly(root.FS()), "(a b)"},
+			{"read-only checks files in the root", `(fs:exists "data.txt")`, profile.ReadOnly(root.FS()), "true"},
+			{"read-only denies writes", `(fs:write "data.txt" "x")`, profile.ReadOnly(root.FS()), "error: unknown symbol `fs:write`"},
+			{"read-only rejects parent escapes", `(fs:read "../secret.txt")`, profile.ReadOnly(root.FS()), "error: `fs:read` failed to read file"},
+			{"read-only rejects absolute paths", `(fs:read "/etc/hostname")`, profile.ReadOnly(root.FS()), "error: `fs:read` failed to read file"},
+			{"read-only rejects symlink escapes", `(fs:read "escape.txt")`, profile.ReadOnly(root.FS()), "error: `fs:read` failed to read file"},
+			{"read-only over an in-memory file system", `(fs:read "notes/todo.txt")`, profile.ReadOnly(mapFS), "write tests"},
+			{"only the given modules", `(+ 1 2)`, nil, "error: unknown symbol `+`"},
+			{"jailed writes in the root", `(fs:mkdir "out") (fs:write "out/new.txt" "x") (fs:append "out/new.txt" "y") (fs:read "out/new.txt")`, jailed(t, dir), "xy"},
+			{"jailed moves in the root", `(fs:write "a.txt" "x") (fs:move "a.txt" "b.txt") (vector (fs:exists "a.txt") (fs:read "b.txt"))`, jailed(t, dir), "(false x)"},
+			{"jailed lists the root", `(fs:list ".")`, jailed(t, dir), "(data.txt escape.txt)"},
+			{"jailed rejects parent escapes", `(fs:write "../evil.txt" "x")`, jailed(t, dir), "error: `fs:write` failed to write file"},
+			{"jailed rejects moves out", `(fs:move "data.txt" "/tmp/data.txt")`, jailed(t, dir), "error: `fs:move` failed to move file"},
+			{"jailed rejects symlink escapes", `(fs:append "escape.txt" "x")`, jailed(t, dir), "error: `fs:append` failed to append to file"},
+			{"jailed has no temporary directory", `(fs:temp-dir)`, jailed(t, dir), "error: unknown symbol `fs:temp-dir`"},
+			{"in-memory writes", `(fs:mkdir "logs") (fs:write "logs/a.txt" "a") (fs:append "logs/a.txt" "b") (vector (fs:is-dir "logs") (fs:list "logs") (fs:size "logs/a.txt"))`, profile.Jailed(stdlib.NewMemoryFileSystem(nil)), "(true (a.txt) 2)"},
+			{"in-memory deletes", `(fs:delete "notes") (fs:exists "notes/todo.txt")`, profile.Jailed(stdlib.NewMemoryFileSystem(map[string]string{"notes/todo.txt": "x"})), "false"},
+			{"in-memory moves directories", `(fs:move "notes" "done") (fs:read "done/todo.txt")`, profile.Jailed(stdlib.NewMemoryFileSystem(map[string]string{"notes/todo.txt": "x"})), "x"},
+			{"in-memory needs the directory", `(fs:write "logs/a.txt" "a")`, profile.Jailed(stdlib.NewMemoryFileSystem(nil)), "error: `fs:write` failed to write file"},
+			{"in-memory rejects parent escapes", `(fs:write "../x.txt" "x")`, profile.Jailed(stdlib.NewMemoryFileSystem(nil)), "error: `fs:write` failed to write file"},
+		}
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				result, err := newBackend(name, sandboxed(tt.modules)).run(buildProgram(t, tt.source))
+
+				expectedErr, isErr := strings.CutPrefix(tt.expect, "error: ")
+
+				switch {
+				case isErr && err == nil:
+					t.Errorf("expected error %q, found value %v", expectedErr, result)
+				case isErr && !strings.Contains(err.Error(), expectedErr):
+					t.Errorf("expected error %q, found %q", expectedErr, err.Error())
+				case !isErr && err != nil:
+					t.Errorf("unexpected error: %v", err)
+				case !isErr && result.String() != tt.expect:
+					t.Errorf("expected %s, found %s", tt.expect, result.String())
+				}
+			})
+		}
+	}
+}
+
+// jailed returns the modules with every file system function jailed in a copy of dir, so writes do not leak between tests.
+func jailed(t *testing.T, dir string) []runtime.Module {
+	copied := t.TempDir()
+
+	if err := os.CopyFS(copied, os.DirFS(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := os.OpenRoot(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { root.Close() })
+
+	return profile.Jailed(stdlib.RootedFileSystem(root))
+}
+
+// TestMemoryFileSystem checks that the in-memory file system behaves like an fs.FS, with its created and implicit directories.
+func TestMemoryFileSystem(t *testing.T) {
+	fsys := stdlib.NewMemoryFileSystem(map[string]string{"notes/todo.txt": "x", "notes/2026/jan.txt": "jan"})
+
+	if err := fsys.MkdirAll("logs"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsys.AppendFile("logs/a.txt", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fstest.TestFS(fsys, "notes/todo.txt", "notes/2026/jan.txt", "logs/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+}